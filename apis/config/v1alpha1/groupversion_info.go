@@ -0,0 +1,41 @@
+/*
+Copyright 2024 Nokia.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "config.sdcio.dev"
+	Version = "v1alpha1"
+)
+
+var (
+	// SchemeGroupVersion is group version used to register these objects
+	SchemeGroupVersion = schema.GroupVersion{Group: Group, Version: Version}
+)
+
+// Repository type metadata.
+var (
+	RepositoryKind                 = reflect.TypeOf(Repository{}).Name()
+	RepositoryListKind             = reflect.TypeOf(RepositoryList{}).Name()
+	RepositoryGroupVersionKind     = SchemeGroupVersion.WithKind(RepositoryKind)
+	RepositoryListGroupVersionKind = SchemeGroupVersion.WithKind(RepositoryListKind)
+)
@@ -54,6 +54,11 @@ type SchemaSpec struct {
 	// Schema provides the details of which files must be used for the models and which files/directories
 	// cana be excludes
 	Schema SchemaSpecSchema `json:"schema" yaml:"schema"`
+
+	// Trust defines the signature verification policy of the ref; when unspecified
+	// the signatures are not verified
+	// +optional
+	Trust *SchemaSpecTrust `json:"trust,omitempty" yaml:"trust,omitempty"`
 }
 
 // SrcDstPath provide a src/dst pair for the loader to download the schema from a specific src
@@ -80,6 +85,25 @@ type SchemaSpecSchema struct {
 	Excludes []string `json:"excludes" yaml:"excludes"`
 }
 
+// SchemaSpecTrust defines the keys that are trusted to sign the tag or commit of
+// the ref. The keys are armored OpenPGP public keys or ssh public keys in
+// authorized_keys format.
+type SchemaSpecTrust struct {
+	// KeyRingSecret is the name of the secret in the namespace of the schema
+	// holding the trusted keys; every data entry of the secret holds keys
+	KeyRingSecret string `json:"keyRingSecret,omitempty" yaml:"keyRingSecret,omitempty"`
+	// KeyRingFile is the path of a local file holding the trusted keys
+	KeyRingFile string `json:"keyRingFile,omitempty" yaml:"keyRingFile,omitempty"`
+	// AllowUnsigned allows unsigned tags and commits; signatures that are present
+	// must still be trusted. An unsigned annotated tag is rejected unless allowed,
+	// in which case the signature of the commit the tag points to is verified
+	AllowUnsigned bool `json:"allowUnsigned,omitempty" yaml:"allowUnsigned,omitempty"`
+	// AllowLightweightTags allows lightweight tags, which cannot be signed, in
+	// which case the signature of the commit the tag points to is verified; an
+	// unsigned commit is rejected unless AllowUnsigned is set
+	AllowLightweightTags bool `json:"allowLightweightTags,omitempty" yaml:"allowLightweightTags,omitempty"`
+}
+
 // SchemaStatus defines the observed state of Schema
 type SchemaStatus struct {
 	// ConditionedStatus provides the status of the Schema using conditions
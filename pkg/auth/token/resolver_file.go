@@ -0,0 +1,37 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/henderiw/git-loader/pkg/auth"
+)
+
+// NewFileResolver returns a resolver reading the credentials from a file in the
+// form <username>:<password or token>
+func NewFileResolver(path string) Resolver {
+	return &FileResolver{path: path}
+}
+
+var _ Resolver = &FileResolver{}
+
+type FileResolver struct {
+	path string
+}
+
+func (b *FileResolver) Resolve(_ context.Context) (auth.Credential, bool, error) {
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot read credentials file %s: %w", b.path, err)
+	}
+	username, password, found := strings.Cut(strings.TrimSpace(string(data)), ":")
+	if !found {
+		return nil, false, fmt.Errorf("invalid credentials file %s: expected <username>:<password>", b.path)
+	}
+	return &TokenCredential{
+		Username: username,
+		Password: password,
+	}, true, nil
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/henderiw/git-loader/pkg/git"
+)
+
+type archiveResult struct {
+	File   string   `json:"file"`
+	Ref    string   `json:"ref"`
+	Commit string   `json:"commit"`
+	Format string   `json:"format"`
+	Files  []string `json:"files"`
+}
+
+func runArchive(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	fs := newFlagSet(cmd, g)
+	ro.addFlags(fs)
+	format := fs.String("format", "", "archive format: tar.gz or zip (default derived from the file name, else tar.gz)")
+	prefix := fs.String("prefix", "", "path prepended to the entries of the archive (default <provider>/<version> of the schema)")
+	filter := fs.Bool("filter", false, "only archive the models and includes of the schema, without the excludes")
+	if err := parseFlags(fs, g, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("expected 1 archive file, got %v", fs.Args())
+	}
+	file := fs.Arg(0)
+	opts := &git.ArchiveOptions{
+		Format: git.ArchiveFormat(*format),
+		Prefix: *prefix,
+	}
+	if opts.Format == "" {
+		opts.Format = git.ArchiveFormatTarGz
+		if strings.HasSuffix(file, ".zip") {
+			opts.Format = git.ArchiveFormatZip
+		}
+	}
+	switch opts.Format {
+	case git.ArchiveFormatTarGz, git.ArchiveFormatZip:
+	default:
+		return usageErrorf("invalid archive format %q", opts.Format)
+	}
+	if *filter && ro.schemaFile == "" {
+		return usageErrorf("-filter requires -schema")
+	}
+
+	repo, cr, err := ro.openRepository(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+	if cr != nil {
+		if opts.Prefix == "" {
+			opts.Prefix = filepath.ToSlash(filepath.Join(cr.Spec.Provider, cr.Spec.Version))
+		}
+		if *filter {
+			opts.Filter = &cr.Spec.Schema
+		}
+	}
+
+	// the archive is written to a temporary file that replaces the file when
+	// complete, such that a failure leaves no partial archive behind
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	archived, err := repo.Archive(ctx, ro.getRef(cr), f, opts)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), file); err != nil {
+		return err
+	}
+
+	result := &archiveResult{
+		File:   file,
+		Ref:    archived.Ref,
+		Commit: archived.Commit.String(),
+		Format: string(archived.Format),
+		Files:  archived.Files,
+	}
+	return g.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "archived %d files of %s (%s) to %s\n", len(result.Files), result.Ref, result.Commit, result.File)
+	})
+}
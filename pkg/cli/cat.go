@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func runCat(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	fs := newFlagSet(cmd, g)
+	ro.addFlags(fs)
+	if err := parseFlags(fs, g, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("expected 1 path, got %v", fs.Args())
+	}
+	p := strings.Trim(fs.Arg(0), "/")
+
+	repo, cr, err := ro.openRepository(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+
+	// the content is written as is, independent of the output format
+	found := false
+	if _, err := repo.List(ctx, ro.getRef(cr), func(ctx context.Context, tree *object.Tree) error {
+		found = true
+		f, err := tree.File(p)
+		if err != nil {
+			return fmt.Errorf("%q: %w", p, err)
+		}
+		// the content of a Git LFS pointer is resolved
+		r, _, err := repo.OpenFile(ctx, f)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(g.stdout, r)
+		return err
+	}); err != nil {
+		return err
+	}
+	if !found {
+		// the directory of the repository does not exist in the ref
+		return fmt.Errorf("%q: %w", p, object.ErrFileNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package cli implements the git-loader command line tool.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/logger/log"
+)
+
+const (
+	defaultRoot = "./schemas"
+)
+
+// command is a subcommand of the tool
+type command struct {
+	name  string
+	usage string
+	short string
+	// run parses the flags of the command and runs it
+	run func(ctx context.Context, cmd *command, g *globalOptions, args []string) error
+}
+
+var commands = []*command{
+	{name: "load-schema", usage: "load-schema [flags] [file|dir]...", short: "copy the schema files of Schemas to <root>/<provider>/<version>", run: runLoadSchema},
+	{name: "ls", usage: "ls [flags] [path]", short: "list the files of a ref", run: runLs},
+	{name: "cat", usage: "cat [flags] <path>", short: "print the content of a file of a ref", run: runCat},
+	{name: "commit", usage: "commit [flags] <file|dir>...", short: "commit files to a package workspace", run: runCommit},
+	{name: "push", usage: "push [flags] <package>/<workspace>", short: "push a package workspace", run: runPush},
+	{name: "import", usage: "import [flags] <archive|dir>", short: "commit the files of a tar.gz archive or directory on a branch", run: runImport},
+	{name: "diff", usage: "diff [flags] <from> <to>", short: "compare 2 revisions", run: runDiff},
+	{name: "archive", usage: "archive [flags] <file>", short: "write the files of a ref to a tar.gz or zip archive", run: runArchive},
+	{name: "tags", usage: "tags [flags]", short: "list the tags and their signatures", run: runTags},
+	{name: "sync", usage: "sync [flags]", short: "load the Schemas and fetch the Repositories of a cluster", run: runSync},
+	{name: "verify", usage: "verify [flags] [<provider>/<version>...]", short: "verify loaded schemas against their manifest", run: runVerify},
+	{name: "gc", usage: "gc [flags]", short: "garbage collect a cached repository and evict the cache", run: runGC},
+}
+
+// globalOptions holds the flags shared by all commands
+type globalOptions struct {
+	root        string
+	cacheRoot   string
+	cacheQuota  int64
+	credentials string
+	output      string
+	lfsEndpoint string
+	// fetchTimeout and pushTimeout bound a single fetch or push
+	fetchTimeout time.Duration
+	pushTimeout  time.Duration
+
+	stdout io.Writer
+	// cache is shared by the repositories opened by the command
+	cache *git.Cache
+}
+
+func (g *globalOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&g.root, "root", defaultRoot, "root directory of the loaded schemas")
+	fs.StringVar(&g.cacheRoot, "cache-root", "", "root directory of the cached repositories (default <root>/git)")
+	fs.Int64Var(&g.cacheQuota, "cache-quota", 0, "maximum size in bytes of the cached repositories; the least recently used repositories are evicted when exceeded (no limit if 0)")
+	fs.StringVar(&g.credentials, "credentials", "env", "credentials source: env (GITHUB_USERNAME/GITHUB_PASSWORD), none or file:<path>")
+	fs.StringVar(&g.output, "output", "text", "output format: text, json or yaml")
+	fs.StringVar(&g.lfsEndpoint, "lfs-endpoint", "", "url of the Git LFS server resolving pointer files, or none (default <repo>.git/info/lfs for http(s) repositories)")
+	fs.DurationVar(&g.fetchTimeout, "fetch-timeout", 0, "maximum duration of a fetch, e.g. 5m (no limit if 0)")
+	fs.DurationVar(&g.pushTimeout, "push-timeout", 0, "maximum duration of a push, e.g. 5m (no limit if 0)")
+}
+
+func (g *globalOptions) validate() error {
+	switch g.output {
+	case outputText, outputJSON, outputYAML:
+	default:
+		return usageErrorf("invalid output format %q", g.output)
+	}
+	if g.cacheRoot == "" {
+		g.cacheRoot = filepath.Join(g.root, "git")
+	}
+	if g.cacheQuota < 0 {
+		return usageErrorf("invalid cache quota %d", g.cacheQuota)
+	}
+	if g.fetchTimeout < 0 {
+		return usageErrorf("invalid fetch timeout %s", g.fetchTimeout)
+	}
+	if g.pushTimeout < 0 {
+		return usageErrorf("invalid push timeout %s", g.pushTimeout)
+	}
+	g.cache = git.NewCache(g.cacheRoot, &git.CacheOptions{Quota: g.cacheQuota})
+	return nil
+}
+
+// Run runs the command line tool with the arguments (without the program
+// name) and returns the exit code.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	log := log.FromContext(ctx)
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return ExitUsage
+		}
+		return ExitOK
+	}
+	cmd := getCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return ExitUsage
+	}
+
+	g := &globalOptions{stdout: stdout}
+	err := cmd.run(ctx, cmd, g, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	code := ExitCode(err)
+	switch code {
+	case ExitOK:
+	case ExitUsage:
+		fmt.Fprintf(stderr, "%s\nusage: git-loader %s\n", err, cmd.usage)
+	default:
+		log.Debug("command failed", "command", cmd.name, "exitCode", code)
+		fmt.Fprintf(stderr, "error: %s\n", err)
+	}
+	return code
+}
+
+// newFlagSet returns the flag set of the command with the global flags
+func newFlagSet(cmd *command, g *globalOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: git-loader %s\n\n%s\n\nflags:\n", cmd.usage, cmd.short)
+		fs.PrintDefaults()
+	}
+	g.addFlags(fs)
+	return fs
+}
+
+// parseFlags parses the flags of a command and validates the global flags. Flags
+// and arguments can be mixed; the arguments are available from fs.Args().
+func parseFlags(fs *flag.FlagSet, g *globalOptions, args []string) error {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return err
+			}
+			return &usageError{err: err}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	// reparse the arguments only such that fs.Args() returns them
+	if err := fs.Parse(append([]string{"--"}, positional...)); err != nil {
+		return &usageError{err: err}
+	}
+	return g.validate()
+}
+
+func getCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: git-loader <command> [flags]\n\ncommands:\n")
+	cmds := make([]*command, len(commands))
+	copy(cmds, commands)
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].name < cmds[j].name })
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(w, "\nrun 'git-loader <command> -h' for the flags of a command\n")
+	fmt.Fprintf(w, "\nexit codes:\n%s", strings.Join(exitCodeDescriptions(), "\n")+"\n")
+}
@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/auth/secret"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/logger/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sschema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	fetchStatusFetched = "fetched"
+	fetchStatusFailed  = "failed"
+)
+
+// clusterOptions holds the flags selecting the cluster and namespace the
+// Schemas and Repositories are read from
+type clusterOptions struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+func (o *clusterOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "path of the kubeconfig file (default $KUBECONFIG, ~/.kube/config or the in-cluster config)")
+	fs.StringVar(&o.context, "context", "", "kubeconfig context (default the current context)")
+	fs.StringVar(&o.namespace, "namespace", "", "namespace of the Schemas and Repositories (default all namespaces)")
+}
+
+// newClient returns a client of the cluster selected by the flags
+func (o *clusterOptions) newClient() (client.Reader, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{
+		CurrentContext: o.context,
+	}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load kubeconfig: %w", err)
+	}
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create client: %w", err)
+	}
+	return c, nil
+}
+
+type fetchRepositoryResult struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type syncResult struct {
+	Schemas      []loadSchemaResult      `json:"schemas"`
+	Repositories []fetchRepositoryResult `json:"repositories"`
+}
+
+func runSync(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	co := &clusterOptions{}
+	flags := newFlagSet(cmd, g)
+	co.addFlags(flags)
+	schemas := flags.Bool("schemas", true, "load the Schemas")
+	repositories := flags.Bool("repositories", true, "fetch the git Repositories into the cache")
+	lo := &loadOptions{}
+	lo.addFlags(flags)
+	if err := parseFlags(flags, g, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return usageErrorf("unexpected arguments %v", flags.Args())
+	}
+	if lo.workers < 1 {
+		return usageErrorf("-workers must be at least 1")
+	}
+
+	c, err := co.newClient()
+	if err != nil {
+		return err
+	}
+	// the repositories provide the credentials of the schemas
+	repos, err := listRepositories(ctx, c, co.namespace)
+	if err != nil {
+		return err
+	}
+
+	result := &syncResult{
+		Schemas:      []loadSchemaResult{},
+		Repositories: []fetchRepositoryResult{},
+	}
+	var errs []error
+	if *schemas {
+		docs, err := listSchemas(ctx, c, co.namespace)
+		if err != nil {
+			return err
+		}
+		results, err := loadSchemas(ctx, g, docs, lo, func(ctx context.Context, cr *invv1alpha1.Schema) (git.GitRepository, error) {
+			return openSchemaRepository(ctx, g, cr, c, findRepository(repos, cr.Namespace, cr.Spec.RepositoryURL))
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if results != nil {
+			result.Schemas = results
+		}
+	}
+	if *repositories {
+		results, err := fetchRepositories(ctx, g, c, repos, lo.workers)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		result.Repositories = results
+	}
+
+	if err := g.print(result, func(w io.Writer) {
+		if *schemas {
+			printLoadSchemaResults(w, result.Schemas)
+		}
+		if *schemas && *repositories {
+			fmt.Fprintln(w)
+		}
+		if *repositories {
+			fmt.Fprintf(w, "REPOSITORY\tURL\tREF\tCOMMIT\tSTATUS\tERROR\n")
+			for _, r := range result.Repositories {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Name, r.URL, r.Ref, r.Commit, r.Status, r.Error)
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	if len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// fetchRepositories fetches the git repositories into the cache concurrently
+func fetchRepositories(ctx context.Context, g *globalOptions, c client.Reader, repos []*configv1alpha1.Repository, workers int) ([]fetchRepositoryResult, error) {
+	results := make([]fetchRepositoryResult, len(repos))
+	errs := make([]error, len(repos))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		results[i] = fetchRepositoryResult{
+			Name:   repo.Namespace + "/" + repo.Name,
+			URL:    repo.Spec.Git.URL,
+			Ref:    repo.Spec.Git.Ref,
+			Status: fetchStatusFailed,
+		}
+		if results[i].Ref == "" {
+			results[i].Ref = string(git.MainBranch)
+		}
+		wg.Add(1)
+		go func(i int, repo *configv1alpha1.Repository) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = fetchRepository(ctx, g, c, repo, &results[i])
+		}(i, repo)
+	}
+	wg.Wait()
+
+	failed := 0
+	var firstErr error
+	for i, err := range errs {
+		if err != nil {
+			results[i].Error = err.Error()
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		results[i].Status = fetchStatusFetched
+	}
+	if failed != 0 {
+		return results, fmt.Errorf("%d of %d repositories failed to fetch: %w", failed, len(results), firstErr)
+	}
+	return results, nil
+}
+
+func fetchRepository(ctx context.Context, g *globalOptions, c client.Reader, repo *configv1alpha1.Repository, result *fetchRepositoryResult) error {
+	r, err := openClusterRepository(ctx, g, c, repo.Namespace, repo.Spec.Git, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close(ctx)
+	info, err := r.Resolve(ctx, result.Ref)
+	if err != nil {
+		return err
+	}
+	result.Commit = info.Commit.String()
+	return nil
+}
+
+// openClusterRepository opens the repository with the credentials of the secret
+// named by the repository in the namespace; without secret the credentials
+// source of the global flags is used.
+func openClusterRepository(ctx context.Context, g *globalOptions, c client.Reader, namespace string, repoCfg *configv1alpha1.GitRepository, trustPolicy *git.TrustPolicy) (git.GitRepository, error) {
+	if repoCfg.Credentials == "" {
+		return g.openRepository(ctx, repoCfg, trustPolicy)
+	}
+	credentialResolver := secret.NewCredentialResolver(c, []secret.Resolver{secret.NewBasicAuthResolver()})
+	return g.openRepositoryWithCredentials(ctx, repoCfg, credentialResolver, namespace, trustPolicy)
+}
+
+// findRepository returns the git repository with the url in the namespace
+func findRepository(repos []*configv1alpha1.Repository, namespace, url string) *configv1alpha1.Repository {
+	for _, repo := range repos {
+		if repo.Namespace == namespace && repo.Spec.Git.URL == url {
+			return repo
+		}
+	}
+	return nil
+}
+
+// listSchemas lists the Schemas of the namespace, or of all namespaces if empty
+func listSchemas(ctx context.Context, c client.Reader, namespace string) ([]schemaDocument, error) {
+	items, err := listObjects(ctx, c, invv1alpha1.SchemaListGroupVersionKind, namespace)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]schemaDocument, 0, len(items))
+	for _, item := range items {
+		cr := &invv1alpha1.Schema{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, cr); err != nil {
+			return nil, fmt.Errorf("cannot convert schema %s/%s: %w", item.GetNamespace(), item.GetName(), err)
+		}
+		docs = append(docs, schemaDocument{source: cr.Namespace + "/" + cr.Name, cr: cr})
+	}
+	return docs, nil
+}
+
+// listRepositories lists the git Repositories of the namespace, or of all
+// namespaces if empty. No repositories are returned when the Repository API is
+// not installed in the cluster.
+func listRepositories(ctx context.Context, c client.Reader, namespace string) ([]*configv1alpha1.Repository, error) {
+	log := log.FromContext(ctx)
+	items, err := listObjects(ctx, c, configv1alpha1.RepositoryListGroupVersionKind, namespace)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			log.Info("repository api not installed, using the credentials source of the flags", "gvk", configv1alpha1.RepositoryGroupVersionKind.String())
+			return nil, nil
+		}
+		return nil, err
+	}
+	repos := make([]*configv1alpha1.Repository, 0, len(items))
+	for _, item := range items {
+		repo := &configv1alpha1.Repository{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, repo); err != nil {
+			return nil, fmt.Errorf("cannot convert repository %s/%s: %w", item.GetNamespace(), item.GetName(), err)
+		}
+		if repo.Spec.Type != "" && repo.Spec.Type != configv1alpha1.RepositoryTypeGit || repo.Spec.Git == nil {
+			continue
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+// listObjects lists the objects as unstructured objects, such that the API types
+// need no registration in the scheme of the client
+func listObjects(ctx context.Context, c client.Reader, gvk k8sschema.GroupVersionKind, namespace string) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk)
+	if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("cannot list %s: %w", gvk.Kind, err)
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/henderiw/git-loader/pkg/git"
+)
+
+type commitResult struct {
+	Ref         string       `json:"ref"`
+	Package     string       `json:"package"`
+	Workspace   string       `json:"workspace"`
+	Parent      string       `json:"parent"`
+	Commit      string       `json:"commit"`
+	Tree        string       `json:"tree"`
+	UpdatedRefs []string     `json:"updatedRefs"`
+	Changes     []fileChange `json:"changes"`
+	DryRun      bool         `json:"dryRun"`
+	Push        *pushResult  `json:"push,omitempty"`
+}
+
+func runCommit(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	flags := newFlagSet(cmd, g)
+	ro.addFlags(flags)
+	packageName := flags.String("package", "", "name of the package, the directory the files are committed to")
+	workspace := flags.String("workspace", "", "name of the workspace; the files are committed on <package>/<workspace>")
+	revision := flags.String("revision", "", "revision of the package revision")
+	message := flags.String("message", "", "commit message")
+	taskType := flags.String("task", "", "type of the task recorded in the commit annotation")
+	push := flags.Bool("push", false, "push the workspace after the commit")
+	dryRun := flags.Bool("dry-run", false, "compute the commit without updating the workspace; nothing is pushed")
+	if err := parseFlags(flags, g, args); err != nil {
+		return err
+	}
+	if *packageName == "" || *workspace == "" {
+		return usageErrorf("-package and -workspace are required")
+	}
+	if flags.NArg() == 0 {
+		return usageErrorf("expected at least 1 file or directory")
+	}
+	resources, modes, err := readResources(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	repo, _, err := ro.openRepository(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+
+	ref := workspaceRef(*packageName + "/" + *workspace)
+	opts := &git.CommitOptions{Message: *message, Modes: modes, DryRun: *dryRun}
+	if *taskType != "" {
+		opts.Task = &git.Task{Type: *taskType}
+	}
+	commit, err := repo.CommitFiles(ctx, ref, *packageName, *workspace, *revision, resources, opts)
+	if err != nil {
+		return err
+	}
+	result := &commitResult{
+		Ref:         ref,
+		Package:     *packageName,
+		Workspace:   *workspace,
+		Parent:      commit.Parent.String(),
+		Commit:      commit.Commit.String(),
+		Tree:        commit.Tree.String(),
+		UpdatedRefs: commit.UpdatedRefs,
+		Changes:     newFileChanges(commit.Changes),
+		DryRun:      commit.DryRun,
+	}
+	if *push && !*dryRun {
+		pushed, err := repo.Push(ctx, ref, nil)
+		if err != nil {
+			return err
+		}
+		result.Push = newPushResult(pushed)
+	}
+	return g.print(result, func(w io.Writer) {
+		verb := "committed"
+		if result.DryRun {
+			verb = "would commit"
+		}
+		fmt.Fprintf(w, "%s %s on %s (parent %s, %d changes)\n", verb, result.Commit, result.Ref, result.Parent, len(result.Changes))
+		for _, c := range result.Changes {
+			fmt.Fprintf(w, "%s\t%s\n", c.Action, c.Path)
+		}
+		if result.Push != nil {
+			printPushResult(w, result.Push)
+		}
+	})
+}
+
+// workspaceRef returns the local reference of a workspace; full reference names
+// are used as is
+func workspaceRef(name string) string {
+	if strings.HasPrefix(name, "refs/") {
+		return name
+	}
+	return git.RefName(name).RefInLocal().String()
+}
+
+// readResources returns the content of the files and their modes; the files in
+// a directory are keyed by their path relative to the directory, other files by
+// their name. The content is streamed from the files when committed. Symlinks
+// in a directory are kept as symlinks, with their target as content.
+func readResources(paths []string) (map[string]git.Content, map[string]filemode.FileMode, error) {
+	resources := map[string]git.Content{}
+	modes := map[string]filemode.FileMode{}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !fi.IsDir() {
+			content, err := git.FileContent(p)
+			if err != nil {
+				return nil, nil, err
+			}
+			resources[filepath.Base(p)] = content
+			modes[filepath.Base(p)] = git.FileModeOf(fi.Mode())
+			continue
+		}
+		if err := filepath.WalkDir(p, func(fp string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			rel, err := filepath.Rel(p, fp)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if d.Type()&fs.ModeSymlink != 0 {
+				target, err := os.Readlink(fp)
+				if err != nil {
+					return err
+				}
+				resources[rel] = git.StringContent(filepath.ToSlash(target))
+				modes[rel] = filemode.Symlink
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			content, err := git.FileContent(fp)
+			if err != nil {
+				return err
+			}
+			resources[rel] = content
+			modes[rel] = git.FileModeOf(fi.Mode())
+			return nil
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return resources, modes, nil
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/henderiw/git-loader/pkg/git"
+)
+
+type diffResult struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Changes []fileChange `json:"changes"`
+}
+
+type fileChange struct {
+	Path     string `json:"path"`
+	Action   string `json:"action"`
+	FromHash string `json:"fromHash,omitempty"`
+	ToHash   string `json:"toHash,omitempty"`
+	Patch    string `json:"patch,omitempty"`
+}
+
+func runDiff(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	fs := newFlagSet(cmd, g)
+	ro.addFlags(fs)
+	patch := fs.Bool("patch", false, "include the unified diff of the changed files")
+	if err := parseFlags(fs, g, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return usageErrorf("expected 2 revisions, got %v", fs.Args())
+	}
+
+	repo, _, err := ro.openRepository(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+
+	diff, err := repo.Diff(ctx, fs.Arg(0), fs.Arg(1), &git.DiffOptions{Patch: *patch})
+	if err != nil {
+		return err
+	}
+	result := &diffResult{
+		From:    diff.From.String(),
+		To:      diff.To.String(),
+		Changes: newFileChanges(diff.Changes),
+	}
+	return g.print(result, func(w io.Writer) {
+		for _, c := range result.Changes {
+			if c.Patch != "" {
+				fmt.Fprint(w, c.Patch)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\n", c.Action, c.Path)
+		}
+	})
+}
+
+func newFileChanges(changes []git.FileChange) []fileChange {
+	result := make([]fileChange, 0, len(changes))
+	for _, c := range changes {
+		fc := fileChange{
+			Path:   c.Path,
+			Action: string(c.Action),
+			Patch:  c.Patch,
+		}
+		if !c.FromHash.IsZero() {
+			fc.FromHash = c.FromHash.String()
+		}
+		if !c.ToHash.IsZero() {
+			fc.ToHash = c.ToHash.String()
+		}
+		result = append(result, fc)
+	}
+	return result
+}
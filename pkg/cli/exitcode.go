@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/lfs"
+	"github.com/henderiw/git-loader/pkg/git/schema"
+	"github.com/henderiw/git-loader/pkg/sign"
+)
+
+// Exit codes of the command line tool
+const (
+	ExitOK = 0
+	// ExitError is returned for errors that are not classified
+	ExitError = 1
+	// ExitUsage is returned for invalid commands, flags or arguments
+	ExitUsage = 2
+	// ExitAuth is returned when the credentials are missing or rejected
+	ExitAuth = 3
+	// ExitNotFound is returned when the repository, ref or file does not exist
+	ExitNotFound = 4
+	// ExitConflict is returned when a push is rejected, a merge has conflicts or a
+	// tag already exists
+	ExitConflict = 5
+	// ExitUntrusted is returned when a signature is missing or not trusted
+	ExitUntrusted = 6
+	// ExitUnavailable is returned for transient failures: the remote is unavailable
+	// or rate limited, a timeout expired or the repository lock is held
+	ExitUnavailable = 7
+	// ExitMismatch is returned when loaded files do not match their manifest
+	ExitMismatch = 8
+)
+
+func exitCodeDescriptions() []string {
+	return []string{
+		fmt.Sprintf("  %d  success", ExitOK),
+		fmt.Sprintf("  %d  error", ExitError),
+		fmt.Sprintf("  %d  invalid usage", ExitUsage),
+		fmt.Sprintf("  %d  authentication failed", ExitAuth),
+		fmt.Sprintf("  %d  repository, ref or file not found", ExitNotFound),
+		fmt.Sprintf("  %d  conflict (push rejected or tag exists)", ExitConflict),
+		fmt.Sprintf("  %d  signature missing or not trusted", ExitUntrusted),
+		fmt.Sprintf("  %d  remote unavailable, timeout or repository locked; retry later", ExitUnavailable),
+		fmt.Sprintf("  %d  files do not match the manifest", ExitMismatch),
+	}
+}
+
+// usageError indicates the command was invoked incorrectly
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+func usageErrorf(format string, a ...any) error {
+	return &usageError{err: fmt.Errorf(format, a...)}
+}
+
+// ExitCode maps an error to the exit code of the tool
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var uerr *usageError
+	switch {
+	case errors.As(err, &uerr):
+		return ExitUsage
+	case errors.Is(err, sign.ErrUnsigned), errors.Is(err, sign.ErrUntrusted):
+		return ExitUntrusted
+	case errors.Is(err, schema.ErrManifestMismatch):
+		return ExitMismatch
+	case errors.Is(err, gogit.ErrTagExists):
+		return ExitConflict
+	case errors.Is(err, git.ErrLockTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ExitUnavailable
+	case errors.Is(err, object.ErrFileNotFound), errors.Is(err, object.ErrDirectoryNotFound),
+		errors.Is(err, plumbing.ErrReferenceNotFound), errors.Is(err, plumbing.ErrObjectNotFound),
+		errors.Is(err, fs.ErrNotExist), errors.Is(err, lfs.ErrObjectNotFound):
+		return ExitNotFound
+	case errors.Is(err, lfs.ErrUnauthorized):
+		return ExitAuth
+	}
+	switch git.GetErrorClass(err) {
+	case git.ErrorClassAuth:
+		return ExitAuth
+	case git.ErrorClassNotFound:
+		return ExitNotFound
+	case git.ErrorClassConflict:
+		return ExitConflict
+	case git.ErrorClassTransient, git.ErrorClassRateLimited:
+		return ExitUnavailable
+	}
+	return ExitError
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/henderiw/git-loader/pkg/git"
+)
+
+type gcResult struct {
+	Repository *repositoryGCResult `json:"repository,omitempty"`
+	Cache      *cacheGCResult      `json:"cache,omitempty"`
+}
+
+type repositoryGCResult struct {
+	PrunedRefs     []string `json:"prunedRefs"`
+	PrunedObjects  int      `json:"prunedObjects"`
+	Repacked       bool     `json:"repacked"`
+	BytesReclaimed int64    `json:"bytesReclaimed"`
+}
+
+type cacheGCResult struct {
+	Evicted        []string `json:"evicted"`
+	BytesReclaimed int64    `json:"bytesReclaimed"`
+	Size           int64    `json:"size"`
+}
+
+func runGC(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	fs := newFlagSet(cmd, g)
+	ro.addFlags(fs)
+	opts := &git.GCOptions{}
+	fs.DurationVar(&opts.PruneExpire, "prune-expire", git.DefaultPruneExpire, "grace period of unreachable objects")
+	fs.DurationVar(&opts.WorkspaceExpire, "workspace-expire", 0, "remove workspaces that were never pushed after this duration; kept if 0")
+	quota := fs.Int64("quota", 0, "evict the least recently used repositories until the cache is within the quota in bytes")
+	if err := parseFlags(fs, g, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageErrorf("unexpected arguments %v", fs.Args())
+	}
+	if !ro.isSet() && *quota == 0 {
+		return usageErrorf("either a repository (-schema or -repo) or -quota is required")
+	}
+
+	result := &gcResult{}
+	if ro.isSet() {
+		repo, _, err := ro.openRepository(ctx, g)
+		if err != nil {
+			return err
+		}
+		res, err := repo.GC(ctx, opts)
+		repo.Close(ctx)
+		if err != nil {
+			return err
+		}
+		result.Repository = &repositoryGCResult{
+			PrunedRefs:     append([]string{}, res.PrunedRefs...),
+			PrunedObjects:  res.PrunedObjects,
+			Repacked:       res.Repacked,
+			BytesReclaimed: res.BytesReclaimed,
+		}
+	}
+	if *quota > 0 {
+		res, err := git.NewCache(g.cacheRoot, &git.CacheOptions{Quota: *quota}).Evict(ctx)
+		if err != nil {
+			return err
+		}
+		result.Cache = &cacheGCResult{
+			Evicted:        append([]string{}, res.Evicted...),
+			BytesReclaimed: res.BytesReclaimed,
+			Size:           res.Size,
+		}
+	}
+	return g.print(result, func(w io.Writer) {
+		if r := result.Repository; r != nil {
+			fmt.Fprintf(w, "repository: pruned %d refs and %d objects, repacked %t, reclaimed %d bytes\n", len(r.PrunedRefs), r.PrunedObjects, r.Repacked, r.BytesReclaimed)
+		}
+		if c := result.Cache; c != nil {
+			fmt.Fprintf(w, "cache: evicted %d repositories, reclaimed %d bytes, size %d bytes\n", len(c.Evicted), c.BytesReclaimed, c.Size)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/henderiw/git-loader/pkg/git"
+)
+
+type importResult struct {
+	Branch      string            `json:"branch"`
+	Source      *git.ImportSource `json:"source"`
+	Parent      string            `json:"parent"`
+	Commit      string            `json:"commit"`
+	Files       int               `json:"files"`
+	Changes     []fileChange      `json:"changes"`
+	Tag         string            `json:"tag,omitempty"`
+	UpdatedRefs []string          `json:"updatedRefs"`
+	DryRun      bool              `json:"dryRun"`
+	Push        *pushResult       `json:"push,omitempty"`
+}
+
+func runImport(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	flags := newFlagSet(cmd, g)
+	ro.addFlags(flags)
+	branch := flags.String("branch", "", "branch the files are imported on; created from main if it does not exist")
+	importPath := flags.String("path", "", "directory the files are imported to, relative to -dir (default -dir); its content is replaced")
+	stripComponents := flags.Int("strip-components", 0, "number of leading path elements removed from the entries of an archive")
+	message := flags.String("message", "", "commit message (default \"Import <source>\")")
+	tag := flags.String("tag", "", "create an annotated tag of the imported commit")
+	push := flags.Bool("push", false, "push the branch and the tag after the import")
+	dryRun := flags.Bool("dry-run", false, "compute the commit without updating the branch or tag; nothing is pushed")
+	if err := parseFlags(flags, g, args); err != nil {
+		return err
+	}
+	if *branch == "" {
+		return usageErrorf("-branch is required")
+	}
+	if *stripComponents < 0 {
+		return usageErrorf("-strip-components must not be negative")
+	}
+	if flags.NArg() != 1 {
+		return usageErrorf("expected 1 archive or directory, got %v", flags.Args())
+	}
+
+	repo, _, err := ro.openRepository(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+
+	imported, err := repo.Import(ctx, *branch, flags.Arg(0), &git.ImportOptions{
+		Path:            *importPath,
+		StripComponents: *stripComponents,
+		Message:         *message,
+		Tag:             *tag,
+		Push:            *push,
+		DryRun:          *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	result := &importResult{
+		Branch:      imported.Branch,
+		Source:      &imported.Source,
+		Parent:      imported.Parent.String(),
+		Commit:      imported.Commit.String(),
+		Files:       imported.Files,
+		Changes:     newFileChanges(imported.Changes),
+		Tag:         imported.Tag,
+		UpdatedRefs: imported.UpdatedRefs,
+		DryRun:      imported.DryRun,
+	}
+	if imported.Push != nil {
+		result.Push = newPushResult(imported.Push)
+	}
+	return g.print(result, func(w io.Writer) {
+		verb := "imported"
+		if result.DryRun {
+			verb = "would import"
+		}
+		fmt.Fprintf(w, "%s %d files of %s as %s on %s (parent %s, %d changes)\n", verb, result.Files, result.Source.Location, result.Commit, result.Branch, result.Parent, len(result.Changes))
+		for _, c := range result.Changes {
+			fmt.Fprintf(w, "%s\t%s\n", c.Action, c.Path)
+		}
+		if result.Tag != "" {
+			fmt.Fprintf(w, "tag %s\n", result.Tag)
+		}
+		if result.Push != nil {
+			printPushResult(w, result.Push)
+		}
+	})
+}
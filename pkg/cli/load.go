@@ -0,0 +1,419 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	defaultLoadWorkers = 4
+
+	loadStatusLoaded = "loaded"
+	loadStatusFailed = "failed"
+)
+
+type loadSchemaResult struct {
+	Source   string `json:"source"`
+	Provider string `json:"provider"`
+	Version  string `json:"version"`
+	URL      string `json:"url"`
+	Ref      string `json:"ref"`
+	Commit   string `json:"commit,omitempty"`
+	Signer   string `json:"signer,omitempty"`
+	Status   string `json:"status"`
+	Files    int    `json:"files"`
+	Path     string `json:"path"`
+	// Added, Changed and Unchanged describe the files of the schema, relative
+	// to the path
+	Added     []string `json:"added"`
+	Changed   []string `json:"changed"`
+	Unchanged int      `json:"unchanged"`
+	Failed    []string `json:"failed,omitempty"`
+	// Deleted holds the files that are no longer in the source directory and
+	// were removed
+	Deleted []string `json:"deleted"`
+	DryRun  bool     `json:"dryRun"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// loadOptions holds the configuration of loading schemas
+type loadOptions struct {
+	// workers is the maximum number of repositories fetched and schemas loaded
+	// concurrently
+	workers int
+	// dryRun computes the files that would be added or changed without writing them
+	dryRun bool
+}
+
+func (o *loadOptions) addFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.workers, "workers", defaultLoadWorkers, "maximum number of repositories fetched and schemas loaded concurrently")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "report the files that would be added or changed without writing them")
+}
+
+// schemaDocument is a Schema read from a file; a file can hold multiple
+// documents
+type schemaDocument struct {
+	source string
+	cr     *invv1alpha1.Schema
+}
+
+func runLoadSchema(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	flags := newFlagSet(cmd, g)
+	schemaPath := flags.String("schema", "", "Schema file, multi-document YAML file or directory of Schema files")
+	lo := &loadOptions{}
+	lo.addFlags(flags)
+	if err := parseFlags(flags, g, args); err != nil {
+		return err
+	}
+	paths := flags.Args()
+	if *schemaPath != "" {
+		paths = append([]string{*schemaPath}, paths...)
+	}
+	if len(paths) == 0 {
+		return usageErrorf("-schema or at least 1 file or directory is required")
+	}
+	if lo.workers < 1 {
+		return usageErrorf("-workers must be at least 1")
+	}
+
+	docs, err := readSchemaDocuments(paths)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("no Schema found in %v: %w", paths, fs.ErrNotExist)
+	}
+
+	results, loadErr := loadSchemas(ctx, g, docs, lo, func(ctx context.Context, cr *invv1alpha1.Schema) (git.GitRepository, error) {
+		return openSchemaRepository(ctx, g, cr, nil, nil)
+	})
+	if err := g.print(results, func(w io.Writer) {
+		printLoadSchemaResults(w, results)
+	}); err != nil {
+		return err
+	}
+	return loadErr
+}
+
+// openSchemaFunc opens the repository of schemas sharing the url and trust policy
+type openSchemaFunc func(ctx context.Context, cr *invv1alpha1.Schema) (git.GitRepository, error)
+
+// loadSchemas loads the schemas concurrently with at most workers repositories
+// being fetched or schemas being loaded at the same time. Every repository is
+// fetched once. The result of every schema is returned, together with an error
+// when a schema failed to load.
+func loadSchemas(ctx context.Context, g *globalOptions, docs []schemaDocument, lo *loadOptions, open openSchemaFunc) ([]loadSchemaResult, error) {
+	results := make([]loadSchemaResult, len(docs))
+	errs := make([]error, len(docs))
+	// schemas loading the same provider version would write to the same
+	// directory; only the first one is loaded
+	loaded := map[string]string{}
+	// schemas of the same repository share the repository such that it is
+	// fetched once
+	groups := map[string][]int{}
+	keys := []string{}
+	for i, doc := range docs {
+		cr := doc.cr
+		results[i] = loadSchemaResult{
+			Source:   doc.source,
+			Provider: cr.Spec.Provider,
+			Version:  cr.Spec.Version,
+			URL:      cr.Spec.RepositoryURL,
+			Ref:      getSchemaRef(cr),
+			Status:   loadStatusFailed,
+			Path:     filepath.Join(g.root, cr.Spec.Provider, cr.Spec.Version),
+			Added:    []string{},
+			Changed:  []string{},
+			Deleted:  []string{},
+			DryRun:   lo.dryRun,
+		}
+		providerVersion := path.Join(cr.Spec.Provider, cr.Spec.Version)
+		if len(cr.Spec.Dirs) > 1 {
+			// the files of a single source directory are loaded and recorded
+			// in the manifest
+			errs[i] = usageErrorf("schema %s defines %d dirs, at most 1 is supported", providerVersion, len(cr.Spec.Dirs))
+			continue
+		}
+		if source, ok := loaded[providerVersion]; ok {
+			errs[i] = usageErrorf("schema %s is also defined in %s", providerVersion, source)
+			continue
+		}
+		loaded[providerVersion] = doc.source
+
+		key, err := repositoryKey(cr)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	sem := make(chan struct{}, lo.workers)
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+			// the schemas of the group share the repository, url and trust policy
+			cr := docs[indexes[0]].cr
+			sem <- struct{}{}
+			repo, err := open(ctx, cr)
+			<-sem
+			if err != nil {
+				for _, i := range indexes {
+					errs[i] = err
+				}
+				return
+			}
+			defer repo.Close(ctx)
+
+			var schemaWg sync.WaitGroup
+			for _, i := range indexes {
+				schemaWg.Add(1)
+				go func(i int) {
+					defer schemaWg.Done()
+					sem <- struct{}{}
+					defer func() { <-sem }()
+					errs[i] = loadSchema(ctx, g, repo, docs[i].cr, lo, &results[i])
+				}(i)
+			}
+			schemaWg.Wait()
+		}(groups[key])
+	}
+	wg.Wait()
+
+	failed := 0
+	var firstErr error
+	for i, err := range errs {
+		// the ready condition of the schema reports why it failed to load, e.g.
+		// an untrusted source
+		cond := schema.GetCondition(err)
+		docs[i].cr.Status.SetConditions(cond)
+		if err != nil {
+			results[i].Error = cond.Message
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		results[i].Status = loadStatusLoaded
+	}
+
+	if failed != 0 {
+		return results, fmt.Errorf("%d of %d schemas failed to load: %w", failed, len(results), firstErr)
+	}
+	return results, nil
+}
+
+func printLoadSchemaResults(w io.Writer, results []loadSchemaResult) {
+	fmt.Fprintf(w, "SCHEMA\tREF\tCOMMIT\tSTATUS\tFILES\tADDED\tCHANGED\tDELETED\tERROR\n")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s/%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", r.Provider, r.Version, r.Ref, r.Commit, r.Status, r.Files, len(r.Added), len(r.Changed), len(r.Deleted), r.Error)
+	}
+}
+
+// openSchemaRepository opens the repository of the schema at the root of the
+// repository; the source directory is selected per schema. The keyring secret of
+// the trust policy is read with the client, if set, and the credentials are
+// resolved with the repository of the cluster, if set.
+func openSchemaRepository(ctx context.Context, g *globalOptions, cr *invv1alpha1.Schema, c client.Reader, repository *configv1alpha1.Repository) (git.GitRepository, error) {
+	trustPolicy, err := (&schema.Schema{RootPath: g.root, CR: cr}).GetTrustPolicy(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	repoCfg := &configv1alpha1.GitRepository{
+		URL: cr.Spec.RepositoryURL,
+		Ref: cr.Spec.Ref,
+	}
+	if repository != nil {
+		repoCfg.Credentials = repository.Spec.Git.Credentials
+		return openClusterRepository(ctx, g, c, repository.Namespace, repoCfg, trustPolicy)
+	}
+	return g.openRepository(ctx, repoCfg, trustPolicy)
+}
+
+// loadSchema copies the files of the source directory of the schema to
+// <root>/<provider>/<version> and records the commit and files in the result
+func loadSchema(ctx context.Context, g *globalOptions, repo git.GitRepository, cr *invv1alpha1.Schema, lo *loadOptions, result *loadSchemaResult) error {
+	ref := getSchemaRef(cr)
+	if !lo.dryRun {
+		if err := os.MkdirAll(result.Path, 0755); err != nil {
+			return err
+		}
+	}
+	src := ""
+	if len(cr.Spec.Dirs) > 0 {
+		src = strings.Trim(path.Clean(cr.Spec.Dirs[0].Src), "/")
+	}
+	s := &schema.Schema{RootPath: g.root, CR: cr}
+	var copied *schema.CopyResult
+	// the ref is resolved and listed at once, such that the manifest records
+	// the commit the files were copied from
+	info, err := repo.List(ctx, ref, func(ctx context.Context, tree *object.Tree) error {
+		if src != "" && src != "." {
+			var err error
+			tree, err = tree.Tree(src)
+			if err != nil {
+				return fmt.Errorf("directory %q: %w", src, err)
+			}
+		}
+		var err error
+		copied, err = s.CopyFiles(ctx, tree, &schema.CopyOptions{DryRun: lo.dryRun, Files: repo})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot load schema %s/%s: %w", cr.Spec.Provider, cr.Spec.Version, err)
+	}
+	result.Commit = info.Commit.String()
+	result.Signer = info.Signer
+	if copied == nil {
+		// the directory of the repository does not exist in the ref
+		return nil
+	}
+	result.Files = copied.Files()
+	result.Added = copied.Added
+	result.Changed = copied.Changed
+	result.Unchanged = copied.Unchanged
+	result.Failed = copied.Failed
+	result.Deleted = copied.Deleted
+	if lo.dryRun {
+		return nil
+	}
+	if err := s.WriteManifest(&schema.Manifest{
+		URL:       cr.Spec.RepositoryURL,
+		Ref:       ref,
+		Commit:    info.Commit.String(),
+		Signer:    info.Signer,
+		Trust:     cr.Spec.Trust,
+		Directory: src,
+		Loaded:    time.Now().UTC(),
+		Files:     copied.Checksums,
+		Failed:    copied.Failed,
+	}); err != nil {
+		return fmt.Errorf("cannot load schema %s/%s: %w", cr.Spec.Provider, cr.Spec.Version, err)
+	}
+	return nil
+}
+
+// getSchemaRef returns the ref of the schema, defaulting to the main branch
+func getSchemaRef(cr *invv1alpha1.Schema) string {
+	if cr.Spec.Ref != "" {
+		return cr.Spec.Ref
+	}
+	return string(git.MainBranch)
+}
+
+// repositoryKey identifies the repository of the schema; schemas with the same
+// url but a different namespace or trust policy cannot share the repository, as
+// the keys and credentials are namespaced.
+func repositoryKey(cr *invv1alpha1.Schema) (string, error) {
+	if cr.Spec.RepositoryURL == "" {
+		return "", fmt.Errorf("schema %s/%s has no repository url", cr.Spec.Provider, cr.Spec.Version)
+	}
+	b, err := json.Marshal(cr.Spec.Trust)
+	if err != nil {
+		return "", err
+	}
+	return cr.Namespace + "\n" + cr.Spec.RepositoryURL + "\n" + string(b), nil
+}
+
+// readSchemaDocuments reads the Schemas from the files and the yaml files in the
+// directories; documents of another kind are skipped.
+func readSchemaDocuments(paths []string) ([]schemaDocument, error) {
+	var docs []schemaDocument
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			fileDocs, err := readSchemaFile(p)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, fileDocs...)
+			continue
+		}
+		if err := filepath.WalkDir(p, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			switch filepath.Ext(name) {
+			case ".yaml", ".yml":
+			default:
+				return nil
+			}
+			fileDocs, err := readSchemaFile(name)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, fileDocs...)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// readSchemaFile reads the Schemas of a single or multi-document yaml file
+func readSchemaFile(fileName string) ([]schemaDocument, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file: %s, err: %w", fileName, err)
+	}
+	defer f.Close()
+
+	var docs []schemaDocument
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	for n := 0; ; n++ {
+		b, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read file: %s, err: %w", fileName, err)
+		}
+		cr := &invv1alpha1.Schema{}
+		if err := yaml.Unmarshal(b, cr); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal file: %s, document %d, err: %w", fileName, n, err)
+		}
+		if cr.Kind != invv1alpha1.SchemaKind {
+			continue
+		}
+		source := fileName
+		if n > 0 {
+			source = fmt.Sprintf("%s#%d", fileName, n)
+		}
+		docs = append(docs, schemaDocument{source: source, cr: cr})
+	}
+	return docs, nil
+}
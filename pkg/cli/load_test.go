@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+	signssh "github.com/henderiw/git-loader/pkg/sign/ssh"
+)
+
+func TestLoadSchemaTrust(t *testing.T) {
+	srv := gittest.NewServer(nil)
+	defer srv.Close()
+	remote, url, err := srv.CreateRepository("schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, keyRing := newTestKey(t, "trusted")
+	other, _ := newTestKey(t, "other")
+	// the tags point to a trusted commit
+	hash, err := gittest.CommitSignedFiles(remote, "main", map[string]string{
+		"yang/a.yang": "module a {}",
+	}, "initial", signssh.NewSigner(signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gittest.CreateSignedTag(remote, "signed", hash, signssh.NewSigner(signer)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gittest.CreateSignedTag(remote, "untrusted", hash, signssh.NewSigner(other)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gittest.CreateTag(remote, "unsigned", hash, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := gittest.CreateTag(remote, "lightweight", hash, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		ref   string
+		trust string
+		code  int
+	}{
+		"signed tag": {
+			ref:  "signed",
+			code: ExitOK,
+		},
+		"untrusted key": {
+			ref:  "untrusted",
+			code: ExitUntrusted,
+		},
+		"unsigned tag": {
+			ref:  "unsigned",
+			code: ExitUntrusted,
+		},
+		"allowed unsigned tag": {
+			ref:   "unsigned",
+			trust: "    allowUnsigned: true\n",
+			code:  ExitOK,
+		},
+		"lightweight tag": {
+			ref:  "lightweight",
+			code: ExitUntrusted,
+		},
+		"allowed lightweight tag": {
+			ref:   "lightweight",
+			trust: "    allowLightweightTags: true\n",
+			code:  ExitOK,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			file := writeTestSchema(t, url, "tag", tc.ref, fmt.Sprintf("  trust:\n    keyRingFile: %s\n%s", keyRing, tc.trust))
+			code, out := runTest(t, "load-schema", "-root", root, "-credentials", "none", file)
+			if code != tc.code {
+				t.Fatalf("expected exit code %d, got %d: %s", tc.code, code, out)
+			}
+			_, err := os.Stat(filepath.Join(root, "test.sdcio.dev", "v1", "a.yang"))
+			switch {
+			case tc.code == ExitOK && err != nil:
+				t.Errorf("expected a.yang to be copied: %v", err)
+			case tc.code != ExitOK && !os.IsNotExist(err):
+				t.Errorf("expected no file to be copied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadSchemaFetchTimeout(t *testing.T) {
+	srv := gittest.NewServer(nil)
+	defer srv.Close()
+	remote, url, err := srv.CreateRepository("schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{
+		"yang/a.yang": "module a {}",
+	}, "initial"); err != nil {
+		t.Fatal(err)
+	}
+	file := writeTestSchema(t, url, "branch", "main", "")
+
+	if code, out := runTest(t, "load-schema", "-root", t.TempDir(), "-fetch-timeout", "-1s", file); code != ExitUsage {
+		t.Fatalf("negative fetch timeout: expected exit code %d, got %d: %s", ExitUsage, code, out)
+	}
+	srv.Stall(transport.UploadPackServiceName, 1)
+	root := t.TempDir()
+	if code, out := runTest(t, "load-schema", "-root", root, "-credentials", "none", "-fetch-timeout", "200ms", file); code != ExitUnavailable {
+		t.Fatalf("stalled fetch: expected exit code %d, got %d: %s", ExitUnavailable, code, out)
+	}
+	if code, out := runTest(t, "load-schema", "-root", root, "-credentials", "none", "-fetch-timeout", "1m", file); code != ExitOK {
+		t.Fatalf("load-schema: exit code %d: %s", code, out)
+	}
+}
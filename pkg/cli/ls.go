@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type fileEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+func runLs(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	fs := newFlagSet(cmd, g)
+	ro.addFlags(fs)
+	if err := parseFlags(fs, g, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return usageErrorf("expected at most 1 path, got %v", fs.Args())
+	}
+	prefix := strings.Trim(fs.Arg(0), "/")
+
+	repo, cr, err := ro.openRepository(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+
+	entries := []fileEntry{}
+	if _, err := repo.List(ctx, ro.getRef(cr), func(ctx context.Context, tree *object.Tree) error {
+		if prefix != "" {
+			t, err := tree.Tree(prefix)
+			if err != nil {
+				if err == object.ErrDirectoryNotFound {
+					// not a directory, check for a single file
+					f, ferr := tree.File(prefix)
+					if ferr != nil {
+						return fmt.Errorf("%q: %w", prefix, object.ErrFileNotFound)
+					}
+					entries = append(entries, newFileEntry(f.Name, f))
+					return nil
+				}
+				return err
+			}
+			tree = t
+		}
+		return tree.Files().ForEach(func(f *object.File) error {
+			entries = append(entries, newFileEntry(path.Join(prefix, f.Name), f))
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+
+	return g.print(entries, func(w io.Writer) {
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", e.Mode, e.Hash, e.Size, e.Path)
+		}
+	})
+}
+
+func newFileEntry(p string, f *object.File) fileEntry {
+	return fileEntry{
+		Path: p,
+		Mode: f.Mode.String(),
+		Hash: f.Hash.String(),
+		Size: f.Size,
+	}
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// print writes the result in the output format; text uses the provided function
+// that writes to a tab aligned writer.
+func (g *globalOptions) print(result any, text func(w io.Writer)) error {
+	switch g.output {
+	case outputJSON:
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("cannot marshal result: %w", err)
+		}
+		_, err = fmt.Fprintln(g.stdout, string(b))
+		return err
+	case outputYAML:
+		b, err := yaml.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("cannot marshal result: %w", err)
+		}
+		_, err = g.stdout.Write(b)
+		return err
+	default:
+		w := tabwriter.NewWriter(g.stdout, 0, 4, 2, ' ', 0)
+		text(w)
+		return w.Flush()
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
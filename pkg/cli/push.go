@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/henderiw/git-loader/pkg/git"
+)
+
+type pushResult struct {
+	Ref         string   `json:"ref"`
+	Commit      string   `json:"commit"`
+	RefSpecs    []string `json:"refSpecs"`
+	UpdatedRefs []string `json:"updatedRefs"`
+	UpToDate    bool     `json:"upToDate"`
+	DryRun      bool     `json:"dryRun"`
+}
+
+func runPush(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	fs := newFlagSet(cmd, g)
+	ro.addFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "compute the refspecs without pushing")
+	if err := parseFlags(fs, g, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("expected 1 workspace, got %v", fs.Args())
+	}
+
+	repo, _, err := ro.openRepository(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+
+	pushed, err := repo.Push(ctx, workspaceRef(fs.Arg(0)), &git.PushOptions{DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	result := newPushResult(pushed)
+	return g.print(result, func(w io.Writer) {
+		printPushResult(w, result)
+	})
+}
+
+func newPushResult(pushed *git.PushResult) *pushResult {
+	return &pushResult{
+		Ref:         pushed.Ref,
+		Commit:      pushed.Commit.String(),
+		RefSpecs:    pushed.RefSpecs,
+		UpdatedRefs: pushed.UpdatedRefs,
+		UpToDate:    pushed.UpToDate,
+		DryRun:      pushed.DryRun,
+	}
+}
+
+func printPushResult(w io.Writer, result *pushResult) {
+	switch {
+	case result.DryRun:
+		fmt.Fprintf(w, "would push %s\n", result.Ref)
+	case result.UpToDate:
+		fmt.Fprintf(w, "%s is up to date\n", result.Ref)
+	default:
+		fmt.Fprintf(w, "pushed %s\n", result.Ref)
+	}
+	for _, spec := range result.RefSpecs {
+		fmt.Fprintf(w, "\t%s\n", spec)
+	}
+}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/auth"
+	"github.com/henderiw/git-loader/pkg/auth/token"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// repoOptions holds the flags selecting the repository: either a Schema file or
+// the url of the repository
+type repoOptions struct {
+	schemaFile string
+	url        string
+	ref        string
+	directory  string
+}
+
+func (o *repoOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.schemaFile, "schema", "", "Schema file defining the repository, ref, directory and trust policy")
+	fs.StringVar(&o.url, "repo", "", "url of the repository; alternative to -schema")
+	fs.StringVar(&o.ref, "ref", "", "branch or tag (default the ref of the schema or main)")
+	fs.StringVar(&o.directory, "dir", "", "directory within the repository (default the first src dir of the schema or the root)")
+}
+
+func (o *repoOptions) isSet() bool {
+	return o.schemaFile != "" || o.url != ""
+}
+
+// openRepository opens the repository selected by the flags; the Schema is
+// returned when the repository is selected by a Schema file.
+func (o *repoOptions) openRepository(ctx context.Context, g *globalOptions) (git.GitRepository, *invv1alpha1.Schema, error) {
+	var cr *invv1alpha1.Schema
+	var trustPolicy *git.TrustPolicy
+	repoCfg := &configv1alpha1.GitRepository{
+		URL:       o.url,
+		Ref:       o.ref,
+		Directory: o.directory,
+	}
+	switch {
+	case o.schemaFile != "" && o.url != "":
+		return nil, nil, usageErrorf("-schema and -repo are mutually exclusive")
+	case o.schemaFile != "":
+		var err error
+		cr, err = readSchema(o.schemaFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		repoCfg.URL = cr.Spec.RepositoryURL
+		if repoCfg.Ref == "" {
+			repoCfg.Ref = cr.Spec.Ref
+		}
+		if repoCfg.Directory == "" && len(cr.Spec.Dirs) > 0 {
+			repoCfg.Directory = cr.Spec.Dirs[0].Src
+		}
+		trustPolicy, err = (&schema.Schema{RootPath: g.root, CR: cr}).GetTrustPolicy(ctx, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+	case o.url == "":
+		return nil, nil, usageErrorf("either -schema or -repo is required")
+	}
+
+	repo, err := g.openRepository(ctx, repoCfg, trustPolicy)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, cr, nil
+}
+
+// openRepository opens the repository in the cache root with the credentials
+// source of the global flags
+func (g *globalOptions) openRepository(ctx context.Context, repoCfg *configv1alpha1.GitRepository, trustPolicy *git.TrustPolicy) (git.GitRepository, error) {
+	credentialResolver, err := g.getCredentialResolver()
+	if err != nil {
+		return nil, err
+	}
+	return g.openRepositoryWithCredentials(ctx, repoCfg, credentialResolver, "", trustPolicy)
+}
+
+// openRepositoryWithCredentials opens the repository in the cache root with the
+// credentials of the secret named by the repository in the namespace
+func (g *globalOptions) openRepositoryWithCredentials(ctx context.Context, repoCfg *configv1alpha1.GitRepository, credentialResolver auth.CredentialResolver, namespace string, trustPolicy *git.TrustPolicy) (git.GitRepository, error) {
+	if err := os.MkdirAll(g.cacheRoot, 0755); err != nil {
+		return nil, err
+	}
+	return git.OpenRepository(ctx, g.cacheRoot, repoCfg, &git.Options{
+		CredentialResolver: credentialResolver,
+		Namespace:          namespace,
+		TrustPolicy:        trustPolicy,
+		Cache:              g.cache,
+		LFS:                g.getLFSOptions(),
+		FetchTimeout:       g.fetchTimeout,
+		PushTimeout:        g.pushTimeout,
+	})
+}
+
+// getLFSOptions returns the configuration of the Git LFS server of the global flags
+func (g *globalOptions) getLFSOptions() *git.LFSOptions {
+	if g.lfsEndpoint == "none" {
+		return &git.LFSOptions{Disabled: true}
+	}
+	return &git.LFSOptions{Endpoint: g.lfsEndpoint}
+}
+
+// getRef returns the ref to read, defaulting to the main branch
+func (o *repoOptions) getRef(cr *invv1alpha1.Schema) string {
+	switch {
+	case o.ref != "":
+		return o.ref
+	case cr != nil && cr.Spec.Ref != "":
+		return cr.Spec.Ref
+	default:
+		return string(git.MainBranch)
+	}
+}
+
+func (g *globalOptions) getCredentialResolver() (auth.CredentialResolver, error) {
+	switch {
+	case g.credentials == "none":
+		return nil, nil
+	case g.credentials == "env":
+		return token.NewCredentialResolver([]token.Resolver{token.NewTokenResolver()}), nil
+	case strings.HasPrefix(g.credentials, "file:"):
+		path := strings.TrimPrefix(g.credentials, "file:")
+		return token.NewCredentialResolver([]token.Resolver{token.NewFileResolver(path)}), nil
+	default:
+		return nil, usageErrorf("invalid credentials source %q", g.credentials)
+	}
+}
+
+func readSchema(fileName string) (*invv1alpha1.Schema, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file: %s, err: %w", fileName, err)
+	}
+	cr := &invv1alpha1.Schema{}
+	if err := yaml.Unmarshal(b, cr); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal file: %s, err: %w", fileName, err)
+	}
+	return cr, nil
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+type tagInfo struct {
+	Name      string `json:"name"`
+	Commit    string `json:"commit"`
+	Annotated bool   `json:"annotated"`
+	Signed    bool   `json:"signed"`
+	Signer    string `json:"signer,omitempty"`
+	Trusted   *bool  `json:"trusted,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func runTags(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	ro := &repoOptions{}
+	fs := newFlagSet(cmd, g)
+	ro.addFlags(fs)
+	if err := parseFlags(fs, g, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageErrorf("unexpected arguments %v", fs.Args())
+	}
+
+	repo, cr, err := ro.openRepository(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+
+	tags, err := repo.Tags(ctx)
+	if err != nil {
+		return err
+	}
+	// trust is only reported when the schema defines a trust policy
+	verified := cr != nil && cr.Spec.Trust != nil
+	result := make([]tagInfo, 0, len(tags))
+	for _, t := range tags {
+		info := tagInfo{
+			Name:      t.Name,
+			Commit:    t.Commit.String(),
+			Annotated: t.Annotated,
+			Signed:    t.Signed,
+			Signer:    t.Signer,
+		}
+		if verified {
+			trusted := t.VerifyErr == nil
+			info.Trusted = &trusted
+			if t.VerifyErr != nil {
+				info.Error = t.VerifyErr.Error()
+			}
+		}
+		result = append(result, info)
+	}
+	return g.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "NAME\tCOMMIT\tANNOTATED\tSIGNED\tTRUSTED\tSIGNER\n")
+		for _, t := range result {
+			trusted := "-"
+			if t.Trusted != nil {
+				trusted = fmt.Sprint(*t.Trusted)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%s\t%s\n", t.Name, t.Commit, t.Annotated, t.Signed, trusted, t.Signer)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/schema"
+)
+
+const (
+	verifyStatusOK    = "ok"
+	verifyStatusDrift = "drift"
+	verifyStatusError = "error"
+)
+
+type verifyResult struct {
+	Path     string   `json:"path"`
+	URL      string   `json:"url,omitempty"`
+	Ref      string   `json:"ref,omitempty"`
+	Commit   string   `json:"commit,omitempty"`
+	Status   string   `json:"status"`
+	Modified []string `json:"modified"`
+	Missing  []string `json:"missing"`
+	Extra    []string `json:"extra"`
+	// RemoteCommit is the commit the ref resolves to in the repository; only
+	// set when the remote is verified
+	RemoteCommit string `json:"remoteCommit,omitempty"`
+	// RemoteSigner is the verified signer of the ref in the repository; only
+	// set when the remote of a manifest with a trust policy is verified
+	RemoteSigner string `json:"remoteSigner,omitempty"`
+	// Upstream holds the files whose blob hash in the manifest does not match
+	// the commit in the repository
+	Upstream []string `json:"upstream,omitempty"`
+	// Failed holds the files of the commit that could not be copied when the
+	// schema was loaded
+	Failed []string `json:"failed,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func runVerify(ctx context.Context, cmd *command, g *globalOptions, args []string) error {
+	flags := newFlagSet(cmd, g)
+	remote := flags.Bool("remote", false, "also verify the ref still resolves to the commit of the manifest and the checksums match the repository")
+	keyRing := flags.String("keyring", "", "file holding the keys trusted to sign the ref with -remote (default the keyring file of the trust policy of the manifest)")
+	if err := parseFlags(flags, g, args); err != nil {
+		return err
+	}
+	if *keyRing != "" && !*remote {
+		return usageErrorf("-keyring requires -remote")
+	}
+
+	dirs := make([]string, 0, flags.NArg())
+	for _, arg := range flags.Args() {
+		dirs = append(dirs, filepath.Join(g.root, arg))
+	}
+	if len(dirs) == 0 {
+		var err error
+		dirs, err = findManifests(g.root)
+		if err != nil {
+			return err
+		}
+		if len(dirs) == 0 {
+			return fmt.Errorf("no schema manifest found in %s: %w", g.root, os.ErrNotExist)
+		}
+	}
+
+	results := make([]verifyResult, 0, len(dirs))
+	failed := 0
+	var firstErr error
+	for _, dir := range dirs {
+		result := verifyResult{Path: dir}
+		if err := verifySchemaDir(ctx, g, dir, *remote, *keyRing, &result); err != nil {
+			result.Status = verifyStatusError
+			if errors.Is(err, schema.ErrManifestMismatch) {
+				result.Status = verifyStatusDrift
+			}
+			result.Error = err.Error()
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			result.Status = verifyStatusOK
+		}
+		results = append(results, result)
+	}
+
+	if err := g.print(results, func(w io.Writer) {
+		fmt.Fprintf(w, "PATH\tCOMMIT\tSTATUS\tMODIFIED\tMISSING\tEXTRA\tERROR\n")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", r.Path, r.Commit, r.Status, len(r.Modified), len(r.Missing), len(r.Extra), r.Error)
+		}
+	}); err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d schemas failed verification: %w", failed, len(results), firstErr)
+	}
+	return nil
+}
+
+// verifySchemaDir compares the files of the schema directory with its manifest
+// and, if requested, the manifest with the repository
+func verifySchemaDir(ctx context.Context, g *globalOptions, dir string, remote bool, keyRing string, result *verifyResult) error {
+	result.Modified = []string{}
+	result.Missing = []string{}
+	result.Extra = []string{}
+
+	m, err := schema.ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+	result.URL = m.URL
+	result.Ref = m.Ref
+	result.Commit = m.Commit
+	result.Failed = m.Failed
+
+	local, err := schema.VerifyManifest(dir, m)
+	if err != nil {
+		return err
+	}
+	result.Modified = local.Modified
+	result.Missing = local.Missing
+	result.Extra = local.Extra
+	if err := local.Err(); err != nil {
+		return err
+	}
+	if !remote {
+		return nil
+	}
+	return verifyManifestRemote(ctx, g, m, keyRing, result)
+}
+
+// verifyManifestRemote checks the ref of the manifest still resolves to the
+// commit of the manifest, signed by the signer of the manifest, and the blob
+// hashes of the manifest match the commit
+func verifyManifestRemote(ctx context.Context, g *globalOptions, m *schema.Manifest, keyRing string, result *verifyResult) error {
+	trustPolicy, err := getManifestTrustPolicy(ctx, g, m, keyRing)
+	if err != nil {
+		return err
+	}
+	repo, err := g.openRepository(ctx, &configv1alpha1.GitRepository{URL: m.URL, Ref: m.Ref}, trustPolicy)
+	if err != nil {
+		return err
+	}
+	defer repo.Close(ctx)
+
+	blobs := map[string]string{}
+	info, err := repo.List(ctx, m.Ref, func(ctx context.Context, tree *object.Tree) error {
+		if m.Directory != "" && m.Directory != "." {
+			var err error
+			tree, err = tree.Tree(m.Directory)
+			if err != nil {
+				return fmt.Errorf("directory %q: %w", m.Directory, err)
+			}
+		}
+		return tree.Files().ForEach(func(f *object.File) error {
+			blobs[f.Name] = f.Hash.String()
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	// the blobs are compared with the commit that was listed
+	result.RemoteCommit = info.Commit.String()
+	if result.RemoteCommit != m.Commit {
+		return fmt.Errorf("%w: ref %s moved from %s to %s", schema.ErrManifestMismatch, m.Ref, m.Commit, result.RemoteCommit)
+	}
+	result.RemoteSigner = info.Signer
+	if trustPolicy != nil && info.Signer != m.Signer {
+		return fmt.Errorf("%w: ref %s is signed by %q, the manifest records %q", schema.ErrManifestMismatch, m.Ref, info.Signer, m.Signer)
+	}
+	// the files that failed to copy are not in the manifest
+	for _, p := range m.Failed {
+		delete(blobs, p)
+	}
+	for _, f := range m.Files {
+		if blobs[f.Path] != f.BlobHash {
+			result.Upstream = append(result.Upstream, f.Path)
+		}
+		delete(blobs, f.Path)
+	}
+	for p := range blobs {
+		if p != schema.ManifestFileName {
+			result.Upstream = append(result.Upstream, p)
+		}
+	}
+	if len(result.Upstream) != 0 {
+		return fmt.Errorf("%w: %d files differ from commit %s", schema.ErrManifestMismatch, len(result.Upstream), m.Commit)
+	}
+	return nil
+}
+
+// getManifestTrustPolicy returns the trust policy the schema of the manifest
+// was loaded with, or nil when it has none. The trusted keys are read from the
+// keyring file, which replaces the keyring file and secret of the policy; the
+// keys of a keyring secret can only be read from a keyring file.
+func getManifestTrustPolicy(ctx context.Context, g *globalOptions, m *schema.Manifest, keyRing string) (*git.TrustPolicy, error) {
+	if m.Trust == nil {
+		if m.Signer != "" {
+			return nil, fmt.Errorf("cannot verify signer %q: the manifest records no trust policy", m.Signer)
+		}
+		return nil, nil
+	}
+	trust := *m.Trust
+	if keyRing != "" {
+		trust.KeyRingSecret = ""
+		trust.KeyRingFile = keyRing
+	}
+	if trust.KeyRingSecret != "" {
+		return nil, fmt.Errorf("cannot read the trusted keys of secret %s: -keyring is required", trust.KeyRingSecret)
+	}
+	cr := &invv1alpha1.Schema{Spec: invv1alpha1.SchemaSpec{Trust: &trust}}
+	return (&schema.Schema{RootPath: g.root, CR: cr}).GetTrustPolicy(ctx, nil)
+}
+
+// findManifests returns the <provider>/<version> directories under root that
+// hold a manifest
+func findManifests(root string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(root, "*", "*", schema.ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, 0, len(matches))
+	for _, match := range matches {
+		dirs = append(dirs, strings.TrimSuffix(match, string(filepath.Separator)+schema.ManifestFileName))
+	}
+	return dirs, nil
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+	signssh "github.com/henderiw/git-loader/pkg/sign/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// newTestKey returns an ssh signer and a file holding its public key in
+// authorized_keys format
+func newTestKey(t *testing.T, name string) (gossh.Signer, string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, gossh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return signer, file
+}
+
+// writeTestSchema writes a Schema loading the yang directory of the ref and
+// returns the file
+func writeTestSchema(t *testing.T, url, kind, ref, trust string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "schema.yaml")
+	content := fmt.Sprintf(`apiVersion: inv.sdcio.dev/v1alpha1
+kind: Schema
+metadata:
+  name: test
+spec:
+  repoURL: %s
+  provider: test.sdcio.dev
+  version: v1
+  kind: %s
+  ref: %s
+  dirs:
+  - src: yang
+    dst: .
+%s`, url, kind, ref, trust)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func runTest(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+func TestVerify(t *testing.T) {
+	srv := gittest.NewServer(nil)
+	defer srv.Close()
+	remote, url, err := srv.CreateRepository("schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{
+		"yang/a.yang": "module a {}",
+		"yang/b.yang": "module b {}",
+	}, "initial"); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	dir := filepath.Join(root, "test.sdcio.dev", "v1")
+	file := writeTestSchema(t, url, "branch", "main", "")
+
+	if code, out := runTest(t, "load-schema", "-root", root, "-credentials", "none", file); code != ExitOK {
+		t.Fatalf("load-schema: exit code %d: %s", code, out)
+	}
+	if code, out := runTest(t, "verify", "-root", root, "-remote", "-credentials", "none"); code != ExitOK {
+		t.Fatalf("verify: exit code %d: %s", code, out)
+	}
+
+	// a file deleted upstream is removed when the schema is loaded again
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{
+		"yang/a.yang": "module a {}",
+	}, "delete b"); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := runTest(t, "verify", "-root", root, "-remote", "-credentials", "none"); code != ExitMismatch {
+		t.Fatalf("verify after the ref moved: expected exit code %d, got %d: %s", ExitMismatch, code, out)
+	}
+	if code, out := runTest(t, "load-schema", "-root", root, "-credentials", "none", file); code != ExitOK {
+		t.Fatalf("load-schema: exit code %d: %s", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.yang")); !os.IsNotExist(err) {
+		t.Errorf("expected b.yang to be removed, got %v", err)
+	}
+	if code, out := runTest(t, "verify", "-root", root, "-remote", "-credentials", "none"); code != ExitOK {
+		t.Fatalf("verify after reload: exit code %d: %s", code, out)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.yang"), []byte("module a { changed }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := runTest(t, "verify", "-root", root); code != ExitMismatch {
+		t.Fatalf("verify of a modified file: expected exit code %d, got %d: %s", ExitMismatch, code, out)
+	}
+}
+
+func TestVerifyRemoteSigner(t *testing.T) {
+	srv := gittest.NewServer(nil)
+	defer srv.Close()
+	remote, url, err := srv.CreateRepository("schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := gittest.CommitFiles(remote, "main", map[string]string{
+		"yang/a.yang": "module a {}",
+	}, "initial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, keyRing := newTestKey(t, "trusted")
+	_, otherKeyRing := newTestKey(t, "other")
+	if err := gittest.CreateSignedTag(remote, "v1", hash, signssh.NewSigner(signer)); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	file := writeTestSchema(t, url, "tag", "v1", fmt.Sprintf("  trust:\n    keyRingFile: %s\n", keyRing))
+
+	if code, out := runTest(t, "load-schema", "-root", root, "-credentials", "none", file); code != ExitOK {
+		t.Fatalf("load-schema: exit code %d: %s", code, out)
+	}
+	code, out := runTest(t, "verify", "-root", root, "-remote", "-credentials", "none", "-output", "json")
+	if code != ExitOK {
+		t.Fatalf("verify: exit code %d: %s", code, out)
+	}
+	if fingerprint := gossh.FingerprintSHA256(signer.PublicKey()); !strings.Contains(out, `"remoteSigner": "`+fingerprint+`"`) {
+		t.Errorf("expected remote signer %s, got %s", fingerprint, out)
+	}
+
+	// the signature of the tag is verified again with the trusted keys
+	if code, out := runTest(t, "verify", "-root", root, "-remote", "-credentials", "none", "-keyring", otherKeyRing); code != ExitUntrusted {
+		t.Fatalf("verify with another key: expected exit code %d, got %d: %s", ExitUntrusted, code, out)
+	}
+	if code, out := runTest(t, "verify", "-root", root, "-keyring", otherKeyRing); code != ExitUsage {
+		t.Fatalf("verify -keyring without -remote: expected exit code %d, got %d: %s", ExitUsage, code, out)
+	}
+}
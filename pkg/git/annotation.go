@@ -3,6 +3,7 @@ package git
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // gitAnnotation is the structured data that we store with commits.
@@ -22,7 +23,27 @@ type gitAnnotation struct {
 	Revision string `json:"revision,omitempty"`
 
 	// Task holds the task we performed, if a task caused the commit.
-	//Task *v1alpha1.Task `json:"task,omitempty"`
+	Task *Task `json:"task,omitempty"`
+
+	// Source holds the origin of the files, if the commit imported them.
+	Source *ImportSource `json:"source,omitempty"`
+}
+
+// Task is the structured record of the change that caused a commit.
+type Task struct {
+	// Type of the task (e.g. init, patch, update)
+	Type string `json:"type"`
+	// Description is a human readable description of the change
+	Description string `json:"description,omitempty"`
+	// Params holds additional task specific data
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Trailer is a git trailer (e.g. Signed-off-by, Change-Id) added at the end of
+// the commit message.
+type Trailer struct {
+	Key   string
+	Value string
 }
 
 // AnnotateCommitMessage adds the gitAnnotation to the commit message.
@@ -36,3 +57,38 @@ func AnnotateCommitMessage(message string, annotation *gitAnnotation) (string, e
 
 	return message, nil
 }
+
+// extractGitAnnotations returns the gitAnnotations stored in the commit message
+func extractGitAnnotations(message string) ([]*gitAnnotation, error) {
+	var annotations []*gitAnnotation
+	for _, line := range strings.Split(message, "\n") {
+		b, found := strings.CutPrefix(line, "annotation:")
+		if !found {
+			continue
+		}
+		annotation := &gitAnnotation{}
+		if err := json.Unmarshal([]byte(b), annotation); err != nil {
+			return nil, fmt.Errorf("error unmarshaling annotation: %w", err)
+		}
+		annotations = append(annotations, annotation)
+	}
+	return annotations, nil
+}
+
+// AddCommitTrailers adds the trailers as the last paragraph of the commit message.
+func AddCommitTrailers(message string, trailers []Trailer) (string, error) {
+	if len(trailers) == 0 {
+		return message, nil
+	}
+	var sb strings.Builder
+	for _, t := range trailers {
+		if t.Key == "" || strings.ContainsAny(t.Key, " \t:\n") {
+			return "", fmt.Errorf("invalid trailer key %q", t.Key)
+		}
+		if strings.Contains(t.Value, "\n") {
+			return "", fmt.Errorf("invalid trailer value for %q: multi-line values are not supported", t.Key)
+		}
+		sb.WriteString(fmt.Sprintf("%s: %s\n", t.Key, t.Value))
+	}
+	return strings.TrimRight(message, "\n") + "\n\n" + sb.String(), nil
+}
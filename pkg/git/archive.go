@@ -0,0 +1,334 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/logger/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ArchiveFormat string
+
+const (
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz"
+	ArchiveFormatZip   ArchiveFormat = "zip"
+)
+
+// ArchiveOptions holds the optional configuration of an archive
+type ArchiveOptions struct {
+	// Format is the format of the archive; defaults to tar.gz
+	Format ArchiveFormat
+	// Prefix is prepended to the paths of the entries in the archive (e.g.
+	// <provider>/<version>)
+	Prefix string
+	// Filter selects the files of the archive: the files in the models and
+	// includes (files or directories relative to the directory of the repository)
+	// that do not match any of the excludes (regular expressions). All files are
+	// selected when the filter has no models and includes.
+	Filter *invv1alpha1.SchemaSpecSchema
+}
+
+// ArchiveResult describes the archive written by Archive
+type ArchiveResult struct {
+	// Ref is the ref that is archived
+	Ref string
+	// Commit is the commit the ref resolved to
+	Commit plumbing.Hash
+	// Format is the format of the archive
+	Format ArchiveFormat
+	// Files holds the paths of the archived files relative to the directory of
+	// the repository, sorted
+	Files []string
+}
+
+// Archive writes the tree of the ref under the directory of the repository as
+// an archive. The entries are sorted by path, have the commit time as
+// modification time and the mode of the tree entry, so the archive of a commit
+// is reproducible byte for byte.
+func (r *gitRepository) Archive(ctx context.Context, ref string, w io.Writer, opts *ArchiveOptions) (*ArchiveResult, error) {
+	ctx, span := tracer.Start(ctx, "gitRepository::Archive", trace.WithAttributes())
+	defer span.End()
+
+	log := log.FromContext(ctx)
+	if opts == nil {
+		opts = &ArchiveOptions{}
+	}
+	format := opts.Format
+	if format == "" {
+		format = ArchiveFormatTarGz
+	}
+	filter, err := newArchiveFilter(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// the files are streamed from the moment they are resolved
+	defer r.walks.startWalk()()
+	commit, files, err := r.getArchiveFiles(ctx, ref, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// the files of the commit are immutable -> they are streamed without the
+	// lock, such that a slow writer does not block commits, pushes and fetches
+	var aw archiveWriter
+	switch format {
+	case ArchiveFormatTarGz:
+		aw = newTarGzArchiveWriter(w)
+	case ArchiveFormatZip:
+		aw = newZipArchiveWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+
+	result := &ArchiveResult{
+		Ref:    ref,
+		Commit: commit.Hash,
+		Format: format,
+		Files:  make([]string, 0, len(files)),
+	}
+	// the commit time makes the archive independent of when it is created
+	modTime := commit.Committer.When.UTC().Truncate(time.Second)
+	prefix := strings.Trim(opts.Prefix, "/")
+	dirs := map[string]bool{}
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name := path.Join(prefix, f.Name)
+		if err := writeArchiveDirs(aw, dirs, path.Dir(name), modTime); err != nil {
+			return nil, err
+		}
+		if err := r.writeArchiveFile(ctx, aw, name, f, modTime); err != nil {
+			return nil, fmt.Errorf("cannot archive file %q: %w", f.Name, err)
+		}
+		result.Files = append(result.Files, f.Name)
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	log.Debug("archive", "ref", ref, "commit", commit.Hash.String(), "format", format, "files", len(result.Files))
+	return result, nil
+}
+
+// getArchiveFiles resolves the ref to the commit and returns the files of the
+// directory of the repository selected by the filter, sorted by path, under the
+// read lock
+func (r *gitRepository) getArchiveFiles(ctx context.Context, ref string, filter *archiveFilter) (*object.Commit, []*object.File, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	commit, _, err := r.getVerifiedCommit(ctx, RefName(ref))
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := r.getRootTree(ctx, commit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []*object.File
+	if err := tree.Files().ForEach(func(f *object.File) error {
+		if filter.match(f.Name) {
+			files = append(files, f)
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return commit, files, nil
+}
+
+// writeArchiveDirs writes the entries of the directory and its parents that
+// are not yet written
+func writeArchiveDirs(aw archiveWriter, dirs map[string]bool, dir string, modTime time.Time) error {
+	if dir == "." || dir == "/" || dir == "" || dirs[dir] {
+		return nil
+	}
+	if err := writeArchiveDirs(aw, dirs, path.Dir(dir), modTime); err != nil {
+		return err
+	}
+	dirs[dir] = true
+	return aw.WriteDir(dir, modTime)
+}
+
+// writeArchiveFile writes the file to the archive; the content of Git LFS
+// pointers is resolved
+func (r *gitRepository) writeArchiveFile(ctx context.Context, aw archiveWriter, name string, f *object.File, modTime time.Time) error {
+	if f.Mode == filemode.Symlink {
+		target, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		return aw.WriteSymlink(name, target, modTime)
+	}
+	mode := fs.FileMode(0644)
+	if f.Mode == filemode.Executable {
+		mode = 0755
+	}
+	rd, size, err := r.OpenFile(ctx, f)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	return aw.WriteFile(name, mode, size, rd, modTime)
+}
+
+// archiveFilter selects the files of an archive
+type archiveFilter struct {
+	paths    []string
+	excludes []*regexp.Regexp
+}
+
+func newArchiveFilter(s *invv1alpha1.SchemaSpecSchema) (*archiveFilter, error) {
+	filter := &archiveFilter{}
+	if s == nil {
+		return filter, nil
+	}
+	for _, p := range append(append([]string{}, s.Models...), s.Includes...) {
+		filter.paths = append(filter.paths, strings.Trim(path.Clean(p), "/"))
+	}
+	for _, exclude := range s.Excludes {
+		re, err := regexp.Compile(exclude)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude %q: %w", exclude, err)
+		}
+		filter.excludes = append(filter.excludes, re)
+	}
+	return filter, nil
+}
+
+func (r *archiveFilter) match(name string) bool {
+	for _, re := range r.excludes {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(r.paths) == 0 {
+		return true
+	}
+	for _, p := range r.paths {
+		if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveWriter writes the entries of an archive
+type archiveWriter interface {
+	WriteDir(name string, modTime time.Time) error
+	WriteFile(name string, mode fs.FileMode, size int64, rd io.Reader, modTime time.Time) error
+	WriteSymlink(name, target string, modTime time.Time) error
+	Close() error
+}
+
+type tarGzArchiveWriter struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzArchiveWriter(w io.Writer) *tarGzArchiveWriter {
+	// the gzip header has no name nor modification time
+	gw := gzip.NewWriter(w)
+	return &tarGzArchiveWriter{gw: gw, tw: tar.NewWriter(gw)}
+}
+
+func (r *tarGzArchiveWriter) WriteDir(name string, modTime time.Time) error {
+	return r.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  modTime,
+	})
+}
+
+func (r *tarGzArchiveWriter) WriteFile(name string, mode fs.FileMode, size int64, rd io.Reader, modTime time.Time) error {
+	if err := r.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode),
+		Size:     size,
+		ModTime:  modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(r.tw, rd)
+	return err
+}
+
+func (r *tarGzArchiveWriter) WriteSymlink(name, target string, modTime time.Time) error {
+	return r.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: target,
+		Mode:     0777,
+		ModTime:  modTime,
+	})
+}
+
+func (r *tarGzArchiveWriter) Close() error {
+	if err := r.tw.Close(); err != nil {
+		return err
+	}
+	return r.gw.Close()
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func newZipArchiveWriter(w io.Writer) *zipArchiveWriter {
+	return &zipArchiveWriter{zw: zip.NewWriter(w)}
+}
+
+func (r *zipArchiveWriter) WriteDir(name string, modTime time.Time) error {
+	h := &zip.FileHeader{Name: name + "/", Modified: modTime}
+	h.SetMode(fs.ModeDir | 0755)
+	_, err := r.zw.CreateHeader(h)
+	return err
+}
+
+func (r *zipArchiveWriter) WriteFile(name string, mode fs.FileMode, size int64, rd io.Reader, modTime time.Time) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+	h.SetMode(mode)
+	fw, err := r.zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, rd)
+	return err
+}
+
+func (r *zipArchiveWriter) WriteSymlink(name, target string, modTime time.Time) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Store, Modified: modTime}
+	h.SetMode(fs.ModeSymlink | 0777)
+	fw, err := r.zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(fw, target)
+	return err
+}
+
+func (r *zipArchiveWriter) Close() error {
+	return r.zw.Close()
+}
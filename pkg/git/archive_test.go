@@ -0,0 +1,151 @@
+package git_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+// importArchiveTestFiles imports a regular, executable and symlinked file on
+// the vendor branch
+func importArchiveTestFiles(t *testing.T, repo git.GitRepository) {
+	t.Helper()
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"yang/a.yang":     "module a;\n",
+		"yang/sub/b.yang": "module b;\n",
+		"yang/c.txt":      "c\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("yang/a.yang", filepath.Join(src, "a.yang")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Import(context.Background(), "vendor", src, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveIsReproducible(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	importArchiveTestFiles(t, repo)
+	ctx := context.Background()
+
+	for _, format := range []git.ArchiveFormat{git.ArchiveFormatTarGz, git.ArchiveFormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			var first, second bytes.Buffer
+			if _, err := repo.Archive(ctx, "vendor", &first, &git.ArchiveOptions{Format: format}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.Archive(ctx, "vendor", &second, &git.ArchiveOptions{Format: format}); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first.Bytes(), second.Bytes()) {
+				t.Fatal("archives of the same commit differ")
+			}
+
+			want := map[string]fs.FileMode{
+				"a.yang":          fs.ModeSymlink,
+				"run.sh":          0755,
+				"yang/a.yang":     0644,
+				"yang/c.txt":      0644,
+				"yang/sub/b.yang": 0644,
+			}
+			if got := readArchiveModes(t, format, first.Bytes()); !reflect.DeepEqual(got, want) {
+				t.Errorf("archived files %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestArchiveFilter(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	importArchiveTestFiles(t, repo)
+
+	var b bytes.Buffer
+	res, err := repo.Archive(context.Background(), "vendor", &b, &git.ArchiveOptions{
+		Prefix: "p/v1",
+		Filter: &invv1alpha1.SchemaSpecSchema{
+			Models:   []string{"yang"},
+			Excludes: []string{`\.txt$`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"yang/a.yang", "yang/sub/b.yang"}; !reflect.DeepEqual(res.Files, want) {
+		t.Errorf("archived files %v, want %v", res.Files, want)
+	}
+	want := map[string]fs.FileMode{
+		"p/v1/yang/a.yang":     0644,
+		"p/v1/yang/sub/b.yang": 0644,
+	}
+	if got := readArchiveModes(t, git.ArchiveFormatTarGz, b.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("archived entries %v, want %v", got, want)
+	}
+}
+
+// readArchiveModes returns the modes of the files and symlinks of the archive
+// by name; the permissions of symlinks are ignored
+func readArchiveModes(t *testing.T, format git.ArchiveFormat, b []byte) map[string]fs.FileMode {
+	t.Helper()
+	modes := map[string]fs.FileMode{}
+	add := func(name string, mode fs.FileMode) {
+		switch {
+		case mode.IsDir():
+		case mode&fs.ModeSymlink != 0:
+			modes[name] = fs.ModeSymlink
+		default:
+			modes[name] = mode.Perm()
+		}
+	}
+	switch format {
+	case git.ArchiveFormatZip:
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			add(f.Name, f.Mode())
+		}
+	default:
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gr)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			add(h.Name, h.FileInfo().Mode())
+		}
+	}
+	return modes
+}
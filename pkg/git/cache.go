@@ -0,0 +1,339 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henderiw/logger/log"
+)
+
+const (
+	// lastUsedFile records the last use of a cached repository
+	lastUsedFile = "last-used"
+	// useSuffix is added to the directory of the cached repository to form the
+	// file that is locked shared by every process that has the repository open;
+	// eviction takes it exclusively.
+	useSuffix = ".use"
+)
+
+// CacheOptions holds the configuration of the cache of repositories
+type CacheOptions struct {
+	// Quota is the maximum size in bytes of the cached repositories; no limit if 0
+	Quota int64
+}
+
+// Cache tracks the size and the last use of the repositories cached under the
+// root directory and evicts the least recently used ones when the size exceeds
+// the quota. Repositories that are open, in this or in another process sharing
+// the root, are never evicted; a repository is in use until it is closed.
+//
+// The size of a directory is measured when it is first seen and again when a
+// repository opened with the cache (see Options) is closed.
+type Cache struct {
+	root  string
+	quota int64
+
+	mu sync.Mutex
+	// inUse holds the number of open repositories by directory
+	inUse map[string]int
+	// sizes holds the measured size by directory
+	sizes map[string]int64
+}
+
+// CacheEntry describes a directory in the cache
+type CacheEntry struct {
+	Dir      string
+	Size     int64
+	LastUsed time.Time
+	InUse    bool
+	// Quarantined indicates the directory holds a corrupted repository that was
+	// moved aside; these are evicted first.
+	Quarantined bool
+}
+
+// EvictResult reports the outcome of an eviction pass
+type EvictResult struct {
+	// Evicted holds the directories that were removed
+	Evicted []string
+	// BytesReclaimed is the disk space that was released
+	BytesReclaimed int64
+	// Size is the size of the cache after eviction
+	Size int64
+}
+
+// NewCache returns a cache for the repositories under root
+func NewCache(root string, opts *CacheOptions) *Cache {
+	if opts == nil {
+		opts = &CacheOptions{}
+	}
+	return &Cache{
+		root:  root,
+		quota: opts.Quota,
+		inUse: map[string]int{},
+		sizes: map[string]int64{},
+	}
+}
+
+// Entries returns the directories in the cache, least recently used first
+func (c *Cache) Entries() ([]CacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entries()
+}
+
+// Evict removes the least recently used repositories that are not in use until
+// the size of the cache is within the quota.
+func (c *Cache) Evict(ctx context.Context) (*EvictResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.evict(ctx)
+}
+
+func (c *Cache) acquire(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inUse[dir]++
+	c.touch(dir)
+}
+
+func (c *Cache) release(ctx context.Context, dir string) {
+	// the repository can have grown -> measure it again, outside of the lock
+	size, err := dirSize(dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.FromContext(ctx).Error("cannot measure cached repository", "dir", dir, "error", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		c.sizes[dir] = size
+	}
+	if c.inUse[dir] <= 1 {
+		delete(c.inUse, dir)
+	} else {
+		c.inUse[dir]--
+	}
+	c.touch(dir)
+
+	if c.quota == 0 {
+		return
+	}
+	if _, err := c.evict(ctx); err != nil {
+		log.FromContext(ctx).Error("cannot evict cached repositories", "root", c.root, "error", err)
+	}
+}
+
+// touch records the use of the repository; the directory does not exist
+// before the repository is cloned
+func (c *Cache) touch(dir string) {
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	_ = touch(filepath.Join(dir, lastUsedFile))
+}
+
+func (c *Cache) evict(ctx context.Context) (*EvictResult, error) {
+	log := log.FromContext(ctx)
+
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+	result := &EvictResult{}
+	for _, e := range entries {
+		result.Size += e.Size
+	}
+	if c.quota == 0 {
+		return result, nil
+	}
+
+	// quarantined directories go first, then least recently used
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Quarantined && !entries[j].Quarantined
+	})
+	for _, e := range entries {
+		if result.Size <= c.quota {
+			break
+		}
+		if e.InUse {
+			continue
+		}
+		if err := c.remove(ctx, e); err != nil {
+			if errors.Is(err, errInUse) {
+				continue
+			}
+			return result, err
+		}
+		log.Info("evicted cached repository", "dir", e.Dir, "size", e.Size, "lastUsed", e.LastUsed)
+		result.Evicted = append(result.Evicted, e.Dir)
+		result.BytesReclaimed += e.Size
+		result.Size -= e.Size
+	}
+	if result.Size > c.quota {
+		log.Info("cache exceeds quota, remaining repositories are in use", "root", c.root, "size", result.Size, "quota", c.quota)
+	}
+	return result, nil
+}
+
+// errInUse is returned when a repository cannot be removed as it is open in
+// another process
+var errInUse = errors.New("cached repository is in use")
+
+// remove deletes the directory of the entry. Other processes sharing the root
+// hold the use lock while the repository is open, so the directory is only
+// removed when the use lock can be taken exclusively. The lock of the
+// repository is taken as well, as a repository that is repaired trades its use
+// lock under that lock (see withExclusiveUse). Quarantined directories are
+// never opened and need no lock.
+func (c *Cache) remove(ctx context.Context, e CacheEntry) error {
+	if !e.Quarantined {
+		for _, suffix := range []string{lockSuffix, useSuffix} {
+			path := e.Dir + suffix
+			l, err := tryLockFile(path, true)
+			if err != nil {
+				return err
+			}
+			if l == nil {
+				return errInUse
+			}
+			defer func() {
+				if err := l.Unlock(); err != nil {
+					log.FromContext(ctx).Error("cannot release repository lock", "path", path, "error", err)
+				}
+			}()
+		}
+	}
+	if err := os.RemoveAll(e.Dir); err != nil {
+		return fmt.Errorf("cannot evict cached repository %s: %w", e.Dir, err)
+	}
+	delete(c.sizes, e.Dir)
+	return nil
+}
+
+func (c *Cache) entries() ([]CacheEntry, error) {
+	des, err := os.ReadDir(c.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries := make([]CacheEntry, 0, len(des))
+	seen := make(map[string]bool, len(des))
+	for _, de := range des {
+		if !de.IsDir() {
+			continue
+		}
+		dir := filepath.Join(c.root, de.Name())
+		seen[dir] = true
+		size, ok := c.sizes[dir]
+		if !ok {
+			if size, err = dirSize(dir); err != nil {
+				return nil, err
+			}
+			c.sizes[dir] = size
+		}
+		fi, err := os.Stat(filepath.Join(dir, lastUsedFile))
+		if err != nil {
+			fi, err = de.Info()
+			if err != nil {
+				return nil, err
+			}
+		}
+		quarantined := strings.Contains(de.Name(), quarantineSuffix)
+		entries = append(entries, CacheEntry{
+			Dir:         dir,
+			Size:        size,
+			LastUsed:    fi.ModTime(),
+			InUse:       c.inUse[dir] > 0 || (!quarantined && isOpen(dir)),
+			Quarantined: quarantined,
+		})
+	}
+	// forget the directories that were removed by other processes
+	for dir := range c.sizes {
+		if !seen[dir] {
+			delete(c.sizes, dir)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// isOpen checks if the repository is open in any of the processes sharing
+// the root
+func isOpen(dir string) bool {
+	if _, err := os.Stat(dir + useSuffix); err != nil {
+		return false
+	}
+	l, err := tryLockFile(dir+useSuffix, true)
+	if err != nil {
+		return false
+	}
+	if l == nil {
+		return true
+	}
+	l.Unlock()
+	return false
+}
+
+// useRepository takes the use lock of the cached repository, shared with the
+// other processes that have the repository open, such that it is not evicted
+// until the lock is released
+func useRepository(ctx context.Context, dir string, timeout time.Duration) (*fileLock, error) {
+	return lockFile(ctx, dir+useSuffix, timeout, false)
+}
+
+// withExclusiveUse runs fn, which moves the directory of the cached repository,
+// with the use lock held exclusively; errInUse is returned when the repository
+// is open elsewhere, in this or in another process. The caller holds the lock
+// of the repository, which keeps the other processes from taking the use lock
+// exclusively while it is traded.
+func withExclusiveUse(ctx context.Context, dir string, use *fileLock, fn func() error) error {
+	upgraded, err := use.upgrade()
+	if err != nil {
+		return err
+	}
+	if !upgraded {
+		return fmt.Errorf("%w: %s", errInUse, dir)
+	}
+	defer func() {
+		if err := use.downgrade(); err != nil {
+			log.FromContext(ctx).Error("cannot share repository use lock", "dir", dir, "error", err)
+		}
+	}()
+	return fn()
+}
+
+// Close releases the repository to the cache, after which it can be evicted.
+// The repository must not be used after it is closed.
+func (r *gitRepository) Close(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.use != nil {
+		if err := r.use.Unlock(); err != nil {
+			log.FromContext(ctx).Error("cannot release repository use lock", "dir", r.dir, "error", err)
+		}
+	}
+	if r.cache != nil && r.dir != "" {
+		r.cache.release(ctx, r.dir)
+	}
+	return nil
+}
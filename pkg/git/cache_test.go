@@ -0,0 +1,98 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newCacheDir creates a cached repository directory holding size bytes
+func newCacheDir(t *testing.T, root, name string, size int, lastUsed time.Time) string {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data"), make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, lastUsedFile), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, lastUsedFile), lastUsed, lastUsed); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCacheEvictSkipsOpenRepositories(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	now := time.Now()
+	open := newCacheDir(t, root, "open", 100, now.Add(-2*time.Hour))
+	old := newCacheDir(t, root, "old", 100, now.Add(-time.Hour))
+	recent := newCacheDir(t, root, "recent", 100, now)
+
+	// the use lock is held as by another process that has the repository open
+	use, err := useRepository(ctx, open, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer use.Unlock()
+
+	c := NewCache(root, &CacheOptions{Quota: 250})
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.InUse != (e.Dir == open) {
+			t.Errorf("%s in use = %t", e.Dir, e.InUse)
+		}
+	}
+
+	res, err := c.Evict(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Evicted) != 1 || res.Evicted[0] != old {
+		t.Errorf("evicted %v, want [%s]", res.Evicted, old)
+	}
+	for _, dir := range []string{open, recent} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s was evicted: %v", dir, err)
+		}
+	}
+}
+
+func TestCacheMeasuresReleasedRepository(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	dir := newCacheDir(t, root, "repo", 100, time.Now())
+
+	c := NewCache(root, nil)
+	size := func() int64 {
+		t.Helper()
+		entries, err := c.Entries()
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("entries %v: %v", entries, err)
+		}
+		return entries[0].Size
+	}
+	initial := size()
+
+	c.acquire(dir)
+	if err := os.WriteFile(filepath.Join(dir, "more"), make([]byte, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the size is measured again when the repository is released
+	if got := size(); got != initial {
+		t.Errorf("size while in use = %d, want %d", got, initial)
+	}
+	c.release(ctx, dir)
+	if got := size(); got != initial+50 {
+		t.Errorf("size after release = %d, want %d", got, initial+50)
+	}
+}
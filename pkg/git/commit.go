@@ -3,6 +3,8 @@ package git
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"path"
 	"sort"
 	"strings"
@@ -11,11 +13,17 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/henderiw/git-loader/pkg/auth"
 )
 
 const (
-	commitSignatureName  = "henderiw"
-	commitSignatureEmail = "wim.henderickx@gmail.com"
+	// default identity used as committer, and as author when the user
+	// cannot be determined
+	defaultCommitSignatureName  = "git-loader"
+	defaultCommitSignatureEmail = "git-loader@localhost"
+
+	// maxSymlinkTargetSize is the maximum length of the target of a symlink
+	maxSymlinkTargetSize = 4096
 )
 
 type commitHelper struct {
@@ -50,17 +58,10 @@ func newCommitHelper(ctx context.Context, repo *gitRepository, parentCommitHash
 		}
 		rootTree = t
 	}
-	fmt.Println("newCommitHelper: rootTree", rootTree)
-	fmt.Println("newCommitHelper: packagePath", packagePath)
-	fmt.Println("newCommitHelper: packageTree", packageTree)
 	if err := ch.initializeTrees(ctx, rootTree, packagePath, packageTree); err != nil {
 		return nil, err
 	}
 
-	for key, val := range ch.trees {
-		fmt.Println("key:", key, "val:", val)
-	}
-
 	return ch, nil
 }
 
@@ -76,7 +77,6 @@ func (r *commitHelper) initializeTrees(ctx context.Context, rootTree *object.Tre
 		// empty package path is invalid
 		return fmt.Errorf("invalid package path: %q", packagePath)
 	}
-	fmt.Println("initializeTrees: parts", parts)
 
 	// Load all ancestor trees
 	parent := rootTree
@@ -104,8 +104,6 @@ func (r *commitHelper) initializeTrees(ctx context.Context, rootTree *object.Tre
 			return fmt.Errorf("path %q is %s, not a directory in tree %s, root %q", path, existing.Mode, existing.Hash, rootTree.Hash)
 		}
 
-		fmt.Println("initializeTrees: setOrAddTreeEntry", name)
-
 		// Set tree in the parent
 		setOrAddTreeEntry(parent, object.TreeEntry{
 			Name: name,
@@ -118,7 +116,6 @@ func (r *commitHelper) initializeTrees(ctx context.Context, rootTree *object.Tre
 	}
 	// Initialize the package tree.
 	lastPart := parts[len(parts)-1]
-	fmt.Println("initializeTrees: lastPart", lastPart)
 	if !packageTreeHash.IsZero() {
 		// Initialize with the supplied package tree.
 		packageTree, err := object.GetTree(r.repository.repo.Storer, packageTreeHash)
@@ -126,14 +123,12 @@ func (r *commitHelper) initializeTrees(ctx context.Context, rootTree *object.Tre
 			return fmt.Errorf("cannot find existing package tree %s for package %q: %w", packageTreeHash, packagePath, err)
 		}
 		r.trees[packagePath] = packageTree
-		fmt.Println("initializeTrees: lastPart add entry", lastPart)
 		setOrAddTreeEntry(parent, object.TreeEntry{
 			Name: lastPart,
 			Mode: filemode.Dir,
 			Hash: plumbing.ZeroHash,
 		})
 	} else {
-		fmt.Println("initializeTrees: lastPart remove entry")
 		// Remove the entry if one exists
 		removeTreeEntry(parent, lastPart)
 	}
@@ -143,31 +138,76 @@ func (r *commitHelper) initializeTrees(ctx context.Context, rootTree *object.Tre
 
 // storeFile writes a blob with contents at the specified path
 func (r *commitHelper) storeFile(path, contents string) error {
-	hash, err := r.storeBlob(contents)
+	return r.storeFileWithMode(path, StringContent(contents), filemode.Regular)
+}
+
+// storeFileWithMode writes a blob with the content at the specified path with
+// the file mode; the content of a symlink is its target.
+func (r *commitHelper) storeFileWithMode(path string, content Content, mode filemode.FileMode) error {
+	if err := validateFileMode(mode, content); err != nil {
+		return fmt.Errorf("%q: %w", path, err)
+	}
+	hash, err := r.storeBlob(content)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("commit storeFile", path, contents, hash)
-
-	if err := r.storeBlobHashInTrees(path, hash); err != nil {
+	if err := r.storeBlobHashInTrees(path, hash, mode); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *commitHelper) storeBlob(val string) (plumbing.Hash, error) {
-	data := []byte(val)
+// lazyWriterStorer is implemented by the filesystem storage, which writes
+// objects without buffering their content in memory
+type lazyWriterStorer interface {
+	LazyWriter() (io.WriteCloser, func(typ plumbing.ObjectType, sz int64) error, error)
+}
+
+// storeBlob streams the content into a blob. The content is buffered in memory
+// only when the storage does not support writing objects lazily.
+func (r *commitHelper) storeBlob(content Content) (hash plumbing.Hash, err error) {
+	rd, err := content.Open()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer rd.Close()
+	size := content.Size()
+
+	if s, ok := r.repository.repo.Storer.(lazyWriterStorer); ok {
+		w, writeHeader, err := s.LazyWriter()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		hw, ok := w.(interface{ Hash() plumbing.Hash })
+		if !ok {
+			w.Close()
+			return plumbing.ZeroHash, fmt.Errorf("object writer does not provide the hash")
+		}
+		if err := writeHeader(plumbing.BlobObject, size); err != nil {
+			w.Close()
+			return plumbing.ZeroHash, err
+		}
+		if err := copyContent(w, rd, size); err != nil {
+			w.Close()
+			return plumbing.ZeroHash, err
+		}
+		if err := w.Close(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		return hw.Hash(), nil
+	}
+
 	eo := r.repository.repo.Storer.NewEncodedObject()
 	eo.SetType(plumbing.BlobObject)
-	eo.SetSize(int64(len(data)))
+	eo.SetSize(size)
 
 	w, err := eo.Writer()
 	if err != nil {
 		return plumbing.Hash{}, err
 	}
 
-	if _, err := w.Write(data); err != nil {
+	if err := copyContent(w, rd, size); err != nil {
 		w.Close()
 		return plumbing.Hash{}, err
 	}
@@ -179,8 +219,20 @@ func (r *commitHelper) storeBlob(val string) (plumbing.Hash, error) {
 	return r.repository.repo.Storer.SetEncodedObject(eo)
 }
 
+// copyContent copies exactly size bytes of the content
+func copyContent(w io.Writer, rd io.Reader, size int64) error {
+	n, err := io.Copy(w, io.LimitReader(rd, size+1))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("content size changed: expected %d bytes, read %d", size, n)
+	}
+	return nil
+}
+
 // storeBlobHashInTrees writes the (previously stored) blob hash at fullpath, marking all the directory trees as dirty.
-func (r *commitHelper) storeBlobHashInTrees(fullPath string, hash plumbing.Hash) error {
+func (r *commitHelper) storeBlobHashInTrees(fullPath string, hash plumbing.Hash, mode filemode.FileMode) error {
 	dir, file := split(fullPath)
 	if file == "" {
 		return fmt.Errorf("invalid resource path: %q; no file name", fullPath)
@@ -189,7 +241,7 @@ func (r *commitHelper) storeBlobHashInTrees(fullPath string, hash plumbing.Hash)
 	tree := r.ensureTree(dir)
 	setOrAddTreeEntry(tree, object.TreeEntry{
 		Name: file,
-		Mode: filemode.Regular,
+		Mode: mode,
 		Hash: hash,
 	})
 
@@ -229,7 +281,6 @@ added:
 
 // storeTrees writes the tree at treePath to git, first writing all child trees.
 func (r *commitHelper) storeTrees(treePath string) (plumbing.Hash, error) {
-	fmt.Println(r.trees)
 	tree, ok := r.trees[treePath]
 	if !ok {
 		return plumbing.Hash{}, fmt.Errorf("failed to find a tree %q", treePath)
@@ -283,16 +334,13 @@ func (r *commitHelper) storeTree(tree *object.Tree) (plumbing.Hash, error) {
 func (r *commitHelper) commit(ctx context.Context, message string, pkgPath string, additionalParentCommits ...plumbing.Hash) (commit, pkgTree plumbing.Hash, err error) {
 	rootTreeHash, err := r.storeTrees("")
 	if err != nil {
-		fmt.Println("commit: storeTrees failed")
 		return plumbing.ZeroHash, plumbing.ZeroHash, err
 	}
 
-	/*
-		var ui *repository.UserInfo
-		if h.userInfoProvider != nil {
-			ui = h.userInfoProvider.GetUserInfo(ctx)
-		}
-	*/
+	var ui *auth.UserInfo
+	if r.repository.userInfoProvider != nil {
+		ui = r.repository.userInfoProvider.GetUserInfo(ctx)
+	}
 
 	var parentCommits []plumbing.Hash
 	if !r.parentCommitHash.IsZero() {
@@ -300,8 +348,7 @@ func (r *commitHelper) commit(ctx context.Context, message string, pkgPath strin
 	}
 	parentCommits = append(parentCommits, additionalParentCommits...)
 
-	fmt.Println("commit: storeCommit", parentCommits, rootTreeHash, message)
-	commitHash, err := r.storeCommit(parentCommits, rootTreeHash, message)
+	commitHash, err := r.storeCommit(parentCommits, rootTreeHash, ui, message)
 	if err != nil {
 		return plumbing.ZeroHash, plumbing.ZeroHash, err
 	}
@@ -319,17 +366,27 @@ func (r *commitHelper) commit(ctx context.Context, message string, pkgPath strin
 }
 
 // storeCommit creates and writes a commit object to git.
-func (r *commitHelper) storeCommit(parentCommits []plumbing.Hash, tree plumbing.Hash, message string) (plumbing.Hash, error) {
+// The user is used as author; the committer is the service identity of the repository.
+// If no user is provided the committer is also used as author.
+func (r *commitHelper) storeCommit(parentCommits []plumbing.Hash, tree plumbing.Hash, ui *auth.UserInfo, message string) (plumbing.Hash, error) {
 	now := time.Now()
+	committer := r.repository.committer
+	author := committer
+	if ui != nil && ui.Name != "" {
+		author = *ui
+		if author.Email == "" {
+			author.Email = ui.Name
+		}
+	}
 	commit := &object.Commit{
 		Author: object.Signature{
-			Name:  commitSignatureName,
-			Email: commitSignatureEmail,
+			Name:  author.Name,
+			Email: author.Email,
 			When:  now,
 		},
 		Committer: object.Signature{
-			Name:  commitSignatureName,
-			Email: commitSignatureEmail,
+			Name:  committer.Name,
+			Email: committer.Email,
 			When:  now,
 		},
 		Message:  message,
@@ -340,6 +397,10 @@ func (r *commitHelper) storeCommit(parentCommits []plumbing.Hash, tree plumbing.
 		commit.ParentHashes = parentCommits
 	}
 
+	if err := r.repository.signCommit(commit); err != nil {
+		return plumbing.Hash{}, err
+	}
+
 	eo := r.repository.repo.Storer.NewEncodedObject()
 	if err := commit.Encode(eo); err != nil {
 		return plumbing.Hash{}, err
@@ -348,10 +409,44 @@ func (r *commitHelper) storeCommit(parentCommits []plumbing.Hash, tree plumbing.
 	if err != nil {
 		return plumbing.Hash{}, err
 	}
-	fmt.Println("storeCommit", hash)
 	return hash, nil
 }
 
+// FileModeOf returns the git file mode of a regular file: executable when any
+// of the exec bits is set
+func FileModeOf(mode fs.FileMode) filemode.FileMode {
+	if mode&0111 != 0 {
+		return filemode.Executable
+	}
+	return filemode.Regular
+}
+
+// validateFileMode checks the mode is supported for files: regular, executable
+// or a symlink with a relative target
+func validateFileMode(mode filemode.FileMode, content Content) error {
+	switch mode {
+	case filemode.Regular, filemode.Executable:
+		return nil
+	case filemode.Symlink:
+		if content.Size() > maxSymlinkTargetSize {
+			return fmt.Errorf("symlink target exceeds %d bytes", maxSymlinkTargetSize)
+		}
+		contents, err := readContent(content)
+		if err != nil {
+			return err
+		}
+		if contents == "" {
+			return fmt.Errorf("symlink without target")
+		}
+		if path.IsAbs(contents) || strings.Contains(contents, "\x00") {
+			return fmt.Errorf("invalid symlink target %q: must be relative", contents)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported file mode %s", mode)
+	}
+}
+
 // Returns a pointer to the entry if found (by name); nil if not found
 func findTreeEntry(tree *object.Tree, name string) *object.TreeEntry {
 	for i := range tree.Entries {
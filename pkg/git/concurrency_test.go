@@ -0,0 +1,111 @@
+package git_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+func TestCommitDuringList(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// a commit must not wait for the walk of the tree to finish
+	if _, err := repo.List(ctx, "main", func(ctx context.Context, tree *object.Tree) error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := repo.Commit(ctx, workspaceRef("pkg", "ws"), "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			t.Fatal("commit is blocked by the list")
+			return nil
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGCWaitsForList(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// GC removes objects, so it must wait for the walk of the tree to finish
+	gcDone := make(chan error, 1)
+	if _, err := repo.List(ctx, "main", func(ctx context.Context, tree *object.Tree) error {
+		go func() {
+			_, err := repo.GC(ctx, nil)
+			gcDone <- err
+		}()
+		select {
+		case err := <-gcDone:
+			t.Fatalf("gc did not wait for the list: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		// the pending GC does not block commits
+		if _, err := repo.Commit(ctx, workspaceRef("pkg", "ws"), "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil); err != nil {
+			return err
+		}
+		return readTree(tree)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-gcDone; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTree reads the content of every file in the tree
+func readTree(tree *object.Tree) error {
+	return tree.Files().ForEach(func(f *object.File) error {
+		_, err := f.Contents()
+		return err
+	})
+}
+
+// TestStress runs concurrent readers and writers against the repository; it is
+// meant to be run with the race detector: go test -race ./pkg/git
+func TestStress(t *testing.T) {
+	for name, inMemory := range map[string]bool{"filesystem": false, "in-memory": true} {
+		t.Run(name, func(t *testing.T) {
+			files := map[string]string{}
+			for i := 0; i < 200; i++ {
+				files[fmt.Sprintf("pkg%d/file%d.yaml", i%10, i)] = fmt.Sprintf("index: %d\n", i)
+			}
+			_, _, url := newTestRemote(t, files)
+			ctx := context.Background()
+			repo, err := git.OpenRepository(ctx, t.TempDir(), &configv1alpha1.GitRepository{
+				URL:         url,
+				Credentials: "credentials",
+			}, &git.Options{
+				CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+				InMemory:           inMemory,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close(ctx)
+
+			opts := &gittest.StressOptions{Push: true}
+			if testing.Short() {
+				opts.Iterations = 3
+			}
+			if err := gittest.Stress(ctx, repo, opts); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
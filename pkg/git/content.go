@@ -0,0 +1,85 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Content is the content of a file that is committed. The content is read
+// when the blob is stored, so large or binary files need not be held in memory.
+type Content interface {
+	// Size returns the size of the content in bytes
+	Size() int64
+	// Open returns a reader of the content; the reader must return exactly
+	// Size bytes
+	Open() (io.ReadCloser, error)
+}
+
+// StringContent returns the string as content
+func StringContent(s string) Content {
+	return stringContent(s)
+}
+
+type stringContent string
+
+func (c stringContent) Size() int64 { return int64(len(c)) }
+
+func (c stringContent) Open() (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(c))), nil
+}
+
+// BytesContent returns the bytes as content; the bytes must not be modified
+// until the content is committed
+func BytesContent(b []byte) Content {
+	return bytesContent(b)
+}
+
+type bytesContent []byte
+
+func (c bytesContent) Size() int64 { return int64(len(c)) }
+
+func (c bytesContent) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(c)), nil
+}
+
+// FileContent returns the content of the file, which is read when committed. It
+// is an error when the size of the file changes in between.
+func FileContent(path string) (Content, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	return &fileContent{path: path, size: fi.Size()}, nil
+}
+
+type fileContent struct {
+	path string
+	size int64
+}
+
+func (c *fileContent) Size() int64 { return c.size }
+
+func (c *fileContent) Open() (io.ReadCloser, error) {
+	return os.Open(c.path)
+}
+
+// readContent returns the content as a string; only meant for small content
+// such as the target of a symlink
+func readContent(c Content) (string, error) {
+	rd, err := c.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rd.Close()
+	b, err := io.ReadAll(rd)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,166 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/henderiw/logger/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ChangeAction string
+
+const (
+	ChangeActionAdded    ChangeAction = "added"
+	ChangeActionModified ChangeAction = "modified"
+	ChangeActionDeleted  ChangeAction = "deleted"
+)
+
+// DiffOptions holds the configuration for comparing 2 revisions
+type DiffOptions struct {
+	// Patch enables the generation of a unified text diff per changed file.
+	Patch bool
+}
+
+// DiffResult is the structured result of comparing 2 revisions
+type DiffResult struct {
+	// From is the commit hash the diff starts from
+	From plumbing.Hash
+	// To is the commit hash the diff ends at
+	To plumbing.Hash
+	// Changes holds the changed files, sorted by path
+	Changes []FileChange
+}
+
+// FileChange describes a single changed file. The path is relative to
+// the directory of the repository.
+type FileChange struct {
+	Path     string
+	Action   ChangeAction
+	FromHash plumbing.Hash
+	ToHash   plumbing.Hash
+	// Patch holds the unified diff of the file, only set when requested
+	Patch string
+}
+
+// Diff compares the trees of 2 revisions (branch, tag, full reference or commit hash)
+// under the directory of the repository. Unchanged subtrees are skipped based on
+// their tree hash, so only the changed parts of the trees are walked.
+func (r *gitRepository) Diff(ctx context.Context, fromRef, toRef string, opts *DiffOptions) (*DiffResult, error) {
+	ctx, span := tracer.Start(ctx, "gitRepository::Diff", trace.WithAttributes())
+	defer span.End()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+
+	fromCommit, err := r.resolveCommit(ctx, fromRef)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := r.resolveCommit(ctx, toRef)
+	if err != nil {
+		return nil, err
+	}
+	for _, commit := range []*object.Commit{fromCommit, toCommit} {
+		if _, err := r.verifyCommit(commit); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := r.diffCommits(ctx, fromCommit, toCommit, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DiffResult{
+		From:    fromCommit.Hash,
+		To:      toCommit.Hash,
+		Changes: changes,
+	}, nil
+}
+
+// diffCommits returns the files changed between the trees of 2 commits under
+// the directory of the repository, sorted by path.
+func (r *gitRepository) diffCommits(ctx context.Context, fromCommit, toCommit *object.Commit, opts *DiffOptions) ([]FileChange, error) {
+	fromTree, err := r.getDiffTree(ctx, fromCommit)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := r.getDiffTree(ctx, toCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, fromTree, toTree, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot diff %s..%s: %w", fromCommit.Hash, toCommit.Hash, err)
+	}
+
+	result := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		fc, err := newFileChange(ctx, change, opts)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *fc)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// getDiffTree returns the tree under the directory of the repository; a nil
+// tree is returned when the directory does not exist in the commit, such that
+// all files are reported as added or deleted.
+func (r *gitRepository) getDiffTree(ctx context.Context, commit *object.Commit) (*object.Tree, error) {
+	log := log.FromContext(ctx)
+	tree, err := r.getRootTree(ctx, commit)
+	if err != nil {
+		if err == object.ErrDirectoryNotFound {
+			log.Info("could not find directory prefix in commit", "path", r.directory, "commit", commit.Hash.String())
+			return nil, nil
+		}
+		return nil, err
+	}
+	return tree, nil
+}
+
+func newFileChange(ctx context.Context, change *object.Change, opts *DiffOptions) (*FileChange, error) {
+	action, err := change.Action()
+	if err != nil {
+		return nil, err
+	}
+	fc := &FileChange{}
+	switch action {
+	case merkletrie.Insert:
+		fc.Action = ChangeActionAdded
+		fc.Path = change.To.Name
+		fc.ToHash = change.To.TreeEntry.Hash
+	case merkletrie.Delete:
+		fc.Action = ChangeActionDeleted
+		fc.Path = change.From.Name
+		fc.FromHash = change.From.TreeEntry.Hash
+	case merkletrie.Modify:
+		fc.Action = ChangeActionModified
+		fc.Path = change.To.Name
+		fc.FromHash = change.From.TreeEntry.Hash
+		fc.ToHash = change.To.TreeEntry.Hash
+	default:
+		return nil, fmt.Errorf("unsupported change action %s", action)
+	}
+
+	if opts.Patch {
+		patch, err := change.PatchContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create patch for %q: %w", fc.Path, err)
+		}
+		fc.Patch = patch.String()
+	}
+	return fc, nil
+}
@@ -0,0 +1,162 @@
+package git_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+	"github.com/henderiw/git-loader/pkg/sign"
+	signssh "github.com/henderiw/git-loader/pkg/sign/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func blobHash(content string) plumbing.Hash {
+	return plumbing.ComputeHash(plumbing.BlobObject, []byte(content))
+}
+
+func TestDiff(t *testing.T) {
+	_, remote, url := newTestRemote(t, map[string]string{
+		"schemas/a.yang":     "a: 1\n",
+		"schemas/b.yang":     "b: 1\n",
+		"schemas/sub/c.yang": "c: 1\n",
+		"other/x.yaml":       "x: 1\n",
+	})
+	from, err := remote.Reference(plumbing.NewBranchReferenceName("main"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := gittest.CommitFiles(remote, "main", map[string]string{
+		"schemas/a.yang":     "a: 2\n",
+		"schemas/sub/c.yang": "c: 1\n",
+		"schemas/sub/d.yang": "d: 1\n",
+		"other/x.yaml":       "x: 2\n",
+	}, "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	// the changes outside of the directory of the repository are ignored
+	repo, err := git.OpenRepository(ctx, t.TempDir(), &configv1alpha1.GitRepository{
+		URL:         url,
+		Credentials: "credentials",
+		Directory:   "schemas",
+	}, &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+		RetryPolicy:        &git.RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+
+	res, err := repo.Diff(ctx, from.Hash().String(), "main", &git.DiffOptions{Patch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.From != from.Hash() || res.To != to {
+		t.Errorf("diff %s..%s, want %s..%s", res.From, res.To, from.Hash(), to)
+	}
+	patches := map[string]string{}
+	for i := range res.Changes {
+		patches[res.Changes[i].Path] = res.Changes[i].Patch
+		res.Changes[i].Patch = ""
+	}
+	want := []git.FileChange{
+		{Path: "a.yang", Action: git.ChangeActionModified, FromHash: blobHash("a: 1\n"), ToHash: blobHash("a: 2\n")},
+		{Path: "b.yang", Action: git.ChangeActionDeleted, FromHash: blobHash("b: 1\n")},
+		{Path: "sub/d.yang", Action: git.ChangeActionAdded, ToHash: blobHash("d: 1\n")},
+	}
+	if !reflect.DeepEqual(res.Changes, want) {
+		t.Errorf("changes %+v, want %+v", res.Changes, want)
+	}
+	if patch := patches["a.yang"]; !strings.Contains(patch, "-a: 1") || !strings.Contains(patch, "+a: 2") {
+		t.Errorf("unexpected patch of a.yang:\n%s", patch)
+	}
+
+	// without a patch requested, none is generated
+	res, err = repo.Diff(ctx, from.Hash().String(), "main", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range res.Changes {
+		if change.Patch != "" {
+			t.Errorf("unexpected patch of %s", change.Path)
+		}
+	}
+}
+
+func TestDiffTrustPolicy(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, remote, url := newTestRemote(t, nil)
+	for branch, signer := range map[string]sign.Signer{
+		"trusted":   signssh.NewSigner(trusted),
+		"untrusted": signssh.NewSigner(other),
+		"unsigned":  nil,
+	} {
+		if _, err := gittest.CommitSignedFiles(remote, branch, map[string]string{"a.yang": branch}, branch, signer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := gittest.CommitSignedFiles(remote, "trusted-next", map[string]string{"a.yang": "next"}, "next", signssh.NewSigner(trusted)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	repo, err := git.OpenRepository(ctx, t.TempDir(), &configv1alpha1.GitRepository{
+		URL:         url,
+		Credentials: "credentials",
+	}, &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+		RetryPolicy:        &git.RetryPolicy{MaxAttempts: 1},
+		TrustPolicy: &git.TrustPolicy{
+			Verifier: signssh.NewVerifier([]gossh.PublicKey{trusted.PublicKey()}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+
+	if _, err := repo.Diff(ctx, "trusted", "trusted-next", nil); err != nil {
+		t.Errorf("diff of trusted commits: %v", err)
+	}
+	// both revisions are verified
+	for _, tc := range []struct {
+		from, to string
+		err      error
+	}{
+		{from: "trusted", to: "untrusted", err: sign.ErrUntrusted},
+		{from: "untrusted", to: "trusted", err: sign.ErrUntrusted},
+		{from: "trusted", to: "unsigned", err: sign.ErrUnsigned},
+		{from: "unsigned", to: "trusted", err: sign.ErrUnsigned},
+	} {
+		if _, err := repo.Diff(ctx, tc.from, tc.to, nil); !errors.Is(err, tc.err) {
+			t.Errorf("diff %s..%s: expected %v, got %v", tc.from, tc.to, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// ErrorClass classifies the errors of operations against the remote repository
+type ErrorClass string
+
+const (
+	// ErrorClassAuth indicates the credentials are missing, invalid or not authorized
+	ErrorClassAuth ErrorClass = "Auth"
+	// ErrorClassNotFound indicates the repository or reference does not exist
+	ErrorClassNotFound ErrorClass = "NotFound"
+	// ErrorClassTransient indicates a network or server failure that can succeed on retry
+	ErrorClassTransient ErrorClass = "Transient"
+	// ErrorClassRateLimited indicates the remote throttles the requests
+	ErrorClassRateLimited ErrorClass = "RateLimited"
+	// ErrorClassConflict indicates the remote reference was updated concurrently
+	ErrorClassConflict ErrorClass = "Conflict"
+	// ErrorClassUnknown is used for all other errors
+	ErrorClassUnknown ErrorClass = "Unknown"
+)
+
+// Errors to match the class of a RemoteError with errors.Is
+var (
+	ErrAuth        = &RemoteError{Class: ErrorClassAuth}
+	ErrNotFound    = &RemoteError{Class: ErrorClassNotFound}
+	ErrTransient   = &RemoteError{Class: ErrorClassTransient}
+	ErrRateLimited = &RemoteError{Class: ErrorClassRateLimited}
+	ErrConflict    = &RemoteError{Class: ErrorClassConflict}
+)
+
+// RemoteError is a classified error of an operation against the remote repository
+type RemoteError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *RemoteError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s error", e.Class)
+	}
+	return e.Err.Error()
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any RemoteError of the same class
+func (e *RemoteError) Is(err error) bool {
+	re, ok := err.(*RemoteError)
+	if !ok {
+		return false
+	}
+	return re.Class == e.Class
+}
+
+// Retryable returns true if the operation can succeed when retried
+func (e *RemoteError) Retryable() bool {
+	return e.Class == ErrorClassTransient || e.Class == ErrorClassRateLimited
+}
+
+// GetErrorClass returns the class of the error or ErrorClassUnknown if
+// the error is not classified.
+func GetErrorClass(err error) ErrorClass {
+	var re *RemoteError
+	if errors.As(err, &re) {
+		return re.Class
+	}
+	return ErrorClassUnknown
+}
+
+// classifyError wraps the error of a remote operation in a RemoteError.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var re *RemoteError
+	if errors.As(err, &re) {
+		return err
+	}
+	return &RemoteError{Class: getErrorClass(err), Err: err}
+}
+
+func getErrorClass(err error) ErrorClass {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassUnknown
+	case errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrInvalidAuthMethod):
+		return ErrorClassAuth
+	case errors.Is(err, transport.ErrRepositoryNotFound),
+		errors.Is(err, git.NoMatchingRefSpecError{}):
+		return ErrorClassNotFound
+	case errors.Is(err, git.ErrForceNeeded),
+		errors.Is(err, git.ErrNonFastForwardUpdate):
+		return ErrorClassConflict
+	case errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE):
+		return ErrorClassTransient
+	}
+
+	var ue *plumbing.UnexpectedError
+	if errors.As(err, &ue) {
+		var he *githttp.Err
+		if errors.As(ue.Err, &he) {
+			switch code := he.StatusCode(); {
+			case code == http.StatusTooManyRequests:
+				return ErrorClassRateLimited
+			case code == http.StatusRequestTimeout, code >= http.StatusInternalServerError:
+				return ErrorClassTransient
+			}
+		}
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return ErrorClassTransient
+	}
+
+	// push rejections are reported by the remote as messages in the report status
+	msg := err.Error()
+	for _, s := range []string{"non-fast-forward", "fetch first", "stale info", "required to be"} {
+		if strings.Contains(msg, s) {
+			return ErrorClassConflict
+		}
+	}
+	return ErrorClassUnknown
+}
@@ -0,0 +1,53 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/henderiw/git-loader/pkg/auth"
+)
+
+func TestDoGitWithAuthWrappedRemoteError(t *testing.T) {
+	r := &gitRepository{local: true, retryPolicy: RetryPolicy{MaxAttempts: 3}}
+	attempts := 0
+	err := r.doGitWithAuth(context.Background(), func(transport.AuthMethod) error {
+		attempts++
+		return fmt.Errorf("push rejected: %w", &RemoteError{Class: ErrorClassConflict, Err: errors.New("fetch first")})
+	})
+	if GetErrorClass(err) != ErrorClassConflict {
+		t.Errorf("error class = %s, want %s: %v", GetErrorClass(err), ErrorClassConflict, err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+type testCredential struct{}
+
+func (testCredential) Valid() bool                        { return true }
+func (testCredential) ToAuthMethod() transport.AuthMethod { return nil }
+
+type testCredentialResolver struct{}
+
+func (testCredentialResolver) ResolveCredential(ctx context.Context, namespace, name string) (auth.Credential, error) {
+	return testCredential{}, nil
+}
+
+func TestGetAuthMethodConcurrent(t *testing.T) {
+	r := &gitRepository{credentialResolver: testCredentialResolver{}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := r.getAuthMethod(context.Background(), i%2 == 0); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,436 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/henderiw/logger/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultPruneExpire is the default grace period of unreachable loose objects
+	DefaultPruneExpire = time.Hour
+	// gcMarkerFile records the time of the last repack in the cached repository
+	gcMarkerFile = "gc.last"
+	// fetchedRefsFile records the local references as they were fetched from
+	// the remote, one "<hash> <name>" per line
+	fetchedRefsFile = "fetched-refs"
+)
+
+// GCOptions holds the configuration of a garbage collection pass
+type GCOptions struct {
+	// PruneExpire is the grace period of unreachable loose objects; younger objects
+	// are kept as they can belong to a commit in progress. Defaults to DefaultPruneExpire.
+	PruneExpire time.Duration
+	// WorkspaceExpire removes local workspace references that were never pushed
+	// when their commit is older than the duration; these are kept if 0.
+	WorkspaceExpire time.Duration
+	// RepackInterval is the minimum time between 2 repacks of the objects;
+	// the objects are repacked on every pass if 0.
+	RepackInterval time.Duration
+}
+
+// GCResult reports the outcome of a garbage collection pass
+type GCResult struct {
+	// PrunedRefs holds the local references that were removed, sorted by name
+	PrunedRefs []string
+	// PrunedObjects is the number of loose objects that were removed
+	PrunedObjects int
+	// Repacked indicates the objects were repacked in this pass
+	Repacked bool
+	// BytesReclaimed is the disk space that was released; always 0 in memory
+	BytesReclaimed int64
+}
+
+// GC fetches the remote and prunes the cached repository:
+//   - references and tags that were fetched from the remote and were deleted in
+//     the remote since are removed; references that were never pushed, e.g. of
+//     Import or Merge, are kept
+//   - local workspace references (see Commit) are removed once their commit is
+//     reachable from the remote or, if configured, when they expired
+//   - unreachable loose objects are deleted and the objects are repacked
+func (r *gitRepository) GC(ctx context.Context, opts *GCOptions) (*GCResult, error) {
+	ctx, span := tracer.Start(ctx, "gitRepository::GC", trace.WithAttributes())
+	defer span.End()
+	// objects are removed -> wait for the walks of List and Archive to end
+	defer r.walks.startRemoval()()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	log := log.FromContext(ctx)
+	if opts == nil {
+		opts = &GCOptions{}
+	}
+	pruneExpire := opts.PruneExpire
+	if pruneExpire == 0 {
+		pruneExpire = DefaultPruneExpire
+	}
+
+	if err := r.fetchRemoteRepository(ctx); err != nil {
+		return nil, err
+	}
+	result := &GCResult{}
+	prunedRefs, err := r.pruneRefs(ctx, opts.WorkspaceExpire)
+	if err != nil {
+		return nil, err
+	}
+	result.PrunedRefs = prunedRefs
+
+	// the objects that were fetched are not reclaimed
+	sizeBefore, err := dirSize(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.dir != "" {
+		prunedObjects, err := r.pruneObjects(time.Now().Add(-pruneExpire))
+		if err != nil {
+			return nil, err
+		}
+		result.PrunedObjects = prunedObjects
+
+		repack, err := r.needsRepack(opts.RepackInterval)
+		if err != nil {
+			return nil, err
+		}
+		if repack {
+			// repacking also removes the loose objects that are packed
+			if err := r.repo.RepackObjects(&git.RepackConfig{}); err != nil {
+				return nil, fmt.Errorf("cannot repack objects: %w", err)
+			}
+			// the old packs are deleted -> drop the cached pack index
+			if s, ok := r.repo.Storer.(interface{ Reindex() }); ok {
+				s.Reindex()
+			}
+			if err := touch(filepath.Join(r.dir, gcMarkerFile)); err != nil {
+				return nil, err
+			}
+			result.Repacked = true
+		}
+	}
+
+	sizeAfter, err := dirSize(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	if sizeBefore > sizeAfter {
+		result.BytesReclaimed = sizeBefore - sizeAfter
+	}
+	log.Info("garbage collected repository", "url", r.url, "refs", len(result.PrunedRefs), "objects", result.PrunedObjects, "repacked", result.Repacked, "bytes", result.BytesReclaimed)
+	return result, nil
+}
+
+// pruneRefs removes the local references that were fetched from the remote and
+// are no longer present in the remote, and the stale local workspaces; the
+// main branch is always kept.
+func (r *gitRepository) pruneRefs(ctx context.Context, workspaceExpire time.Duration) ([]string, error) {
+	log := log.FromContext(ctx)
+
+	remoteRefs, err := r.listRemoteRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fetched, err := r.readFetchedRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*plumbing.Reference
+	refs, err := r.repo.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || ref.Name() == DefaultMainReferenceName || ref.Name() == r.ref.RefInLocal() {
+			return nil
+		}
+		remoteName, err := refInRemoteFromRefInLocal(ref.Name())
+		if err != nil {
+			// not a reference that is mirrored from the remote
+			return nil
+		}
+		if hash, ok := remoteRefs[remoteName]; ok {
+			if hash == ref.Hash() {
+				// mirrors the remote, e.g. after a push
+				fetched[ref.Name()] = hash
+			}
+			return nil
+		}
+		candidates = append(candidates, ref)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, ref := range candidates {
+		// a reference that still points to the fetched commit was deleted in the
+		// remote; a reference that was updated locally has commits that were not
+		// pushed
+		remove := fetched[ref.Name()] == ref.Hash()
+		if !remove && ref.Name().IsRemote() {
+			// a workspace that only exists locally is kept until its commit is part of
+			// the remote or it expired
+			remove, err = r.isStaleWorkspace(ref, remoteRefs, workspaceExpire)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !remove {
+			continue
+		}
+		if err := r.repo.Storer.RemoveReference(ref.Name()); err != nil {
+			return nil, fmt.Errorf("cannot remove reference %s: %w", ref.Name(), err)
+		}
+		delete(fetched, ref.Name())
+		log.Debug("pruned reference", "ref", ref.Name().String(), "hash", ref.Hash().String())
+		pruned = append(pruned, ref.Name().String())
+	}
+	sort.Strings(pruned)
+	return pruned, r.writeFetchedRefs(fetched)
+}
+
+// localRefs returns the hash references of the repository by name
+func (r *gitRepository) localRefs() (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	refs, err := r.repo.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	result := map[plumbing.ReferenceName]plumbing.Hash{}
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			result[ref.Name()] = ref.Hash()
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// recordFetchedRefs records the references that were created or updated by a
+// fetch, given the references before the fetch
+func (r *gitRepository) recordFetchedRefs(before map[plumbing.ReferenceName]plumbing.Hash) error {
+	after, err := r.localRefs()
+	if err != nil {
+		return err
+	}
+	fetched, err := r.readFetchedRefs()
+	if err != nil {
+		return err
+	}
+	for name, hash := range after {
+		if before[name] != hash {
+			fetched[name] = hash
+		}
+	}
+	// forget the references that no longer exist
+	for name := range fetched {
+		if _, ok := after[name]; !ok {
+			delete(fetched, name)
+		}
+	}
+	return r.writeFetchedRefs(fetched)
+}
+
+// readFetchedRefs returns the local references by name with the commit they
+// were fetched at. The record is kept in memory for in-memory repositories.
+func (r *gitRepository) readFetchedRefs() (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	fetched := map[plumbing.ReferenceName]plumbing.Hash{}
+	if r.dir == "" {
+		for name, hash := range r.fetchedRefs {
+			fetched[name] = hash
+		}
+		return fetched, nil
+	}
+	b, err := os.ReadFile(filepath.Join(r.dir, fetchedRefsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fetched, nil
+		}
+		return nil, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok || !plumbing.IsHash(hash) {
+			continue
+		}
+		fetched[plumbing.ReferenceName(name)] = plumbing.NewHash(hash)
+	}
+	return fetched, nil
+}
+
+func (r *gitRepository) writeFetchedRefs(fetched map[plumbing.ReferenceName]plumbing.Hash) error {
+	if r.dir == "" {
+		r.fetchedRefs = fetched
+		return nil
+	}
+	lines := make([]string, 0, len(fetched))
+	for name, hash := range fetched {
+		lines = append(lines, hash.String()+" "+name.String()+"\n")
+	}
+	sort.Strings(lines)
+	// replace the record atomically such that it is never read partially
+	p := filepath.Join(r.dir, fetchedRefsFile)
+	if err := os.WriteFile(p+".tmp", []byte(strings.Join(lines, "")), 0644); err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// listRemoteRefs returns the references of the remote by name
+func (r *gitRepository) listRemoteRefs(ctx context.Context) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	remote, err := r.repo.Remote(OriginName)
+	if err != nil {
+		return nil, err
+	}
+	var refs []*plumbing.Reference
+	switch err := r.doGitWithAuth(ctx, func(auth transport.AuthMethod) error {
+		var err error
+		refs, err = remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+		return err
+	}); err {
+	case nil:
+	case transport.ErrEmptyRemoteRepository:
+	default:
+		return nil, fmt.Errorf("cannot list references of repository %q: %w", r.url, err)
+	}
+	remoteRefs := make(map[plumbing.ReferenceName]plumbing.Hash, len(refs))
+	for _, ref := range refs {
+		remoteRefs[ref.Name()] = ref.Hash()
+	}
+	return remoteRefs, nil
+}
+
+// isStaleWorkspace checks if a local only reference can be removed: the
+// workspace commit is reachable from one of the remote references or is older
+// than the expiry. References that were not created by Commit are kept.
+// Workspaces that were pushed and deleted in the remote before they were
+// fetched are kept until expiry as they cannot be told apart from workspaces
+// that were never pushed.
+func (r *gitRepository) isStaleWorkspace(ref *plumbing.Reference, remoteRefs map[plumbing.ReferenceName]plumbing.Hash, expire time.Duration) (bool, error) {
+	commit, err := r.repo.CommitObject(ref.Hash())
+	if err != nil {
+		// the reference does not point to a commit we have -> nothing to keep
+		return errors.Is(err, plumbing.ErrObjectNotFound), nil
+	}
+	annotations, err := extractGitAnnotations(commit.Message)
+	if err != nil {
+		return false, err
+	}
+	workspace := false
+	for _, a := range annotations {
+		if a.WorkspaceName != "" {
+			workspace = true
+		}
+	}
+	if !workspace {
+		// not created by Commit, e.g. by Import or Merge -> never pushed
+		return false, nil
+	}
+	if expire > 0 && time.Since(commit.Committer.When) > expire {
+		return true, nil
+	}
+	for name, hash := range remoteRefs {
+		if !name.IsBranch() {
+			continue
+		}
+		if hash == commit.Hash {
+			return true, nil
+		}
+		remoteCommit, err := r.repo.CommitObject(hash)
+		if err != nil {
+			// not fetched
+			continue
+		}
+		ok, err := commit.IsAncestor(remoteCommit)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *gitRepository) needsRepack(interval time.Duration) (bool, error) {
+	if interval == 0 {
+		return true, nil
+	}
+	fi, err := os.Stat(filepath.Join(r.dir, gcMarkerFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return time.Since(fi.ModTime()) >= interval, nil
+}
+
+func touch(p string) error {
+	if err := os.WriteFile(p, nil, 0644); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(p, now, now)
+}
+
+// pruneObjects deletes the unreachable loose objects older than expire
+func (r *gitRepository) pruneObjects(expire time.Time) (int, error) {
+	count := 0
+	if err := r.repo.Prune(git.PruneOptions{
+		OnlyObjectsOlderThan: expire,
+		Handler: func(hash plumbing.Hash) error {
+			if err := r.repo.DeleteObject(hash); err != nil {
+				return fmt.Errorf("cannot delete object %s: %w", hash, err)
+			}
+			count++
+			return nil
+		},
+	}); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// dirSize returns the total size of the files in the directory; 0 when the
+// directory is empty (in memory)
+func dirSize(dir string) (int64, error) {
+	if dir == "" {
+		return 0, nil
+	}
+	var size int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
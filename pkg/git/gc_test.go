@@ -0,0 +1,101 @@
+package git_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+func TestGCKeepsUnpushedRefs(t *testing.T) {
+	_, remote, url := newTestRemote(t, nil)
+	hash, err := gittest.CommitFiles(remote, "old/ws", map[string]string{"old/a.yaml": "a: 1\n"}, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gittest.CreateTag(remote, "v0", hash, true); err != nil {
+		t.Fatal(err)
+	}
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+
+	// an import with a tag and a workspace that were never pushed
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "b.yaml"), []byte("b: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Import(ctx, "vendor", src, &git.ImportOptions{Tag: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit(ctx, workspaceRef("pkg", "ws"), "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fetched branch and tag are deleted in the remote
+	for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName("old/ws"), plumbing.NewTagReferenceName("v0")} {
+		if err := remote.Storer.RemoveReference(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := repo.GC(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"refs/remotes/origin/old/ws", "refs/tags/v0"}
+	if !reflect.DeepEqual(res.PrunedRefs, want) {
+		t.Errorf("pruned refs %v, want %v", res.PrunedRefs, want)
+	}
+	for _, ref := range []string{"vendor", "v1", "pkg/ws"} {
+		if _, err := repo.Resolve(ctx, ref); err != nil {
+			t.Errorf("unpushed ref %s was pruned: %v", ref, err)
+		}
+	}
+}
+
+func TestGCReclaimsUnreferencedObjects(t *testing.T) {
+	_, remote, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+
+	// the fetched objects outgrow the objects of the workspace that is never
+	// pushed
+	if _, err := repo.Commit(ctx, workspaceRef("pkg", "ws"), "pkg", "ws", "v1", map[string]string{"c.yaml": randomContent(t, 1<<20)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{"d.yaml": randomContent(t, 2<<20)}, "large"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := repo.GC(ctx, &git.GCOptions{PruneExpire: time.Nanosecond, WorkspaceExpire: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{workspaceRef("pkg", "ws")}; !reflect.DeepEqual(res.PrunedRefs, want) {
+		t.Errorf("pruned refs %v, want %v", res.PrunedRefs, want)
+	}
+	if res.PrunedObjects == 0 {
+		t.Errorf("no objects were pruned")
+	}
+	if res.BytesReclaimed <= 0 {
+		t.Errorf("reclaimed %d bytes, want more than 0", res.BytesReclaimed)
+	}
+}
+
+// randomContent returns size bytes of content that cannot be compressed much
+func randomContent(t *testing.T, size int) string {
+	t.Helper()
+	b := make([]byte, size/2)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
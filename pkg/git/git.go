@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -15,6 +17,8 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
 	"github.com/henderiw/git-loader/pkg/auth"
+	"github.com/henderiw/git-loader/pkg/git/lfs"
+	"github.com/henderiw/git-loader/pkg/sign"
 	"github.com/henderiw/logger/log"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
@@ -23,76 +27,220 @@ import (
 var tracer = otel.Tracer("git")
 
 type GitRepository interface {
-	List(ctx context.Context, ref string, listFn ListFunc) error
-	Commit(ctx context.Context, ref, packageName, workspaceName, revision string, resources map[string]string) error
-	Push(ctx context.Context, ref string) error
+	List(ctx context.Context, ref string, listFn ListFunc) (*RefInfo, error)
+	Archive(ctx context.Context, ref string, w io.Writer, opts *ArchiveOptions) (*ArchiveResult, error)
+	Import(ctx context.Context, branch, src string, opts *ImportOptions) (*ImportResult, error)
+	OpenFile(ctx context.Context, f *object.File) (io.ReadCloser, int64, error)
+	Resolve(ctx context.Context, ref string) (*RefInfo, error)
+	Commit(ctx context.Context, ref, packageName, workspaceName, revision string, resources map[string]string, opts *CommitOptions) (*CommitResult, error)
+	CommitFiles(ctx context.Context, ref, packageName, workspaceName, revision string, files map[string]Content, opts *CommitOptions) (*CommitResult, error)
+	Push(ctx context.Context, ref string, opts *PushOptions) (*PushResult, error)
+	Diff(ctx context.Context, fromRef, toRef string, opts *DiffOptions) (*DiffResult, error)
+	Merge(ctx context.Context, ref, packageName string) (*MergeResult, error)
+	Tags(ctx context.Context) ([]TagInfo, error)
+	Verify(ctx context.Context) error
+	Repair(ctx context.Context) error
+	GC(ctx context.Context, opts *GCOptions) (*GCResult, error)
+	Close(ctx context.Context) error
 }
 
 type gitRepository struct {
 	url                string
+	local              bool    // local (file) remotes need no credentials
+	dir                string  // directory of the cached bare repository; empty when in memory
 	secret             string  // Secret containing Credentials
+	namespace          string  // namespace of the secret
 	ref                RefName // The main branch from repository registration (defaults to 'main' if unspecified)
 	directory          string
 	repo               *git.Repository
 	credentialResolver auth.CredentialResolver
 	userInfoProvider   auth.UserInfoProvider
+	// committer is the service identity used as committer of the commits
+	committer auth.UserInfo
+	// signer signs the commits, if set
+	signer sign.Signer
+	// trustPolicy defines the signatures that are trusted on read, if set
+	trustPolicy *TrustPolicy
+	// retryPolicy defines how remote operations are retried
+	retryPolicy  RetryPolicy
+	fetchTimeout time.Duration
+	pushTimeout  time.Duration
+	// lockTimeout is the time to wait for the lock of the cached repository
+	lockTimeout time.Duration
+	// cache tracks the use of the cached repository, if set
+	cache *Cache
+	// use is the shared use lock of the cached repository, held until it is
+	// closed such that no process evicts it
+	use *fileLock
+	// closed indicates the repository is released to the cache
+	closed bool
+	// lfs resolves the Git LFS pointers, if configured
+	lfs *lfs.Client
+	// fetchedRefs records the fetched references of an in-memory repository;
+	// see readFetchedRefs
+	fetchedRefs map[plumbing.ReferenceName]plumbing.Hash
 
 	// credential contains the information needed to authenticate against
 	// a git repository.
 	credential auth.Credential
-
-	mu sync.Mutex
+	// credentialMu guards the credential, which is resolved by readers (LFS) and
+	// writers alike
+	credentialMu sync.Mutex
+
+	// mu serializes the operations that update references or objects (commit,
+	// push, fetch, merge, gc); reads of the immutable commit objects share the lock.
+	mu sync.RWMutex
+	// walks keeps the objects of the trees walked without mu from being removed
+	walks walkGuard
 }
 
 type Options struct {
 	CredentialResolver auth.CredentialResolver
-	UserInfoProvider   auth.UserInfoProvider
+	// Namespace is the namespace of the secret holding the credentials, which is
+	// named by the Credentials of the repository
+	Namespace string
+	// UserInfoProvider provides the user on whose behalf a commit is made;
+	// the user is recorded as the author of the commit
+	UserInfoProvider auth.UserInfoProvider
+	// Committer is the service identity recorded as the committer of the commits;
+	// defaults to git-loader <git-loader@localhost>
+	Committer *auth.UserInfo
+	// Signer signs the commits created by the repository; commits are unsigned if not set
+	Signer sign.Signer
+	// InMemory backs the repository with in-memory storage instead of a bare
+	// repository under root; nothing is written to the filesystem and the
+	// cached objects are lost when the repository is released
+	InMemory bool
+	// FetchTimeout limits the duration of a fetch, including retries; no limit if 0
+	FetchTimeout time.Duration
+	// PushTimeout limits the duration of a push, including retries; no limit if 0
+	PushTimeout time.Duration
+	// RetryPolicy defines how remote operations are retried; defaults to DefaultRetryPolicy
+	RetryPolicy *RetryPolicy
+	// TrustPolicy defines the signatures that are trusted when reading tags
+	// and commits; when not set signatures are not verified
+	TrustPolicy *TrustPolicy
+	// LockTimeout is the time to wait for the lock of the cached repository,
+	// which is shared by the processes using the same root; defaults to DefaultLockTimeout
+	LockTimeout time.Duration
+	// Cache tracks the size and the use of the repository and evicts the least
+	// recently used repositories when it is closed. Root must be the root of
+	// the cache. A cached repository is never evicted while open, also by other
+	// processes, so it must be closed when done.
+	Cache *Cache
+	// LFS configures how Git LFS pointers are resolved when files are read;
+	// pointers of http(s) repositories are resolved by default
+	LFS *LFSOptions
 }
 
 func OpenRepository(ctx context.Context, root string, repoCfg *configv1alpha1.GitRepository, opts *Options) (GitRepository, error) {
 	ctx, span := tracer.Start(ctx, "OpenRepository", trace.WithAttributes())
 	defer span.End()
 
-	replace := strings.NewReplacer("/", "-", ":", "-")
-	dir := filepath.Join(root, replace.Replace(repoCfg.URL))
+	url, local, err := normalizeURL(repoCfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid git repository url %q: %w", repoCfg.URL, err)
+	}
 
-	// Cleanup the directory in case initialization fails.
-	cleanup := dir
+	// Cleanup the directory and release it to the cache in case initialization fails.
+	cleanup := ""
+	release := ""
+	var use *fileLock
 	defer func() {
 		if cleanup != "" {
 			os.RemoveAll(cleanup)
 		}
+		if use != nil {
+			use.Unlock()
+		}
+		if release != "" {
+			opts.Cache.release(ctx, release)
+		}
 	}()
 
 	var repo *git.Repository
+	var dir string
+	lockTimeout := opts.LockTimeout
+	if lockTimeout == 0 {
+		lockTimeout = DefaultLockTimeout
+	}
 
-	// check if the directory exists (<init-dir>/<git>/<repo-url w/ replaced / and :>)
-	if fi, err := os.Stat(dir); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-		r, err := initEmptyRepository(dir)
+	if opts.InMemory {
+		r, err := initMemoryRepository()
 		if err != nil {
 			return nil, fmt.Errorf("error cloning git repository %q: %w", repoCfg.URL, err)
 		}
-
 		repo = r
-
-	} else if !fi.IsDir() {
-		// file exists but is not a directory -> corruption
-		return nil, fmt.Errorf("cannot clone git repository %q: %w", repoCfg.URL, err)
 	} else {
-		// director that exists
-		cleanup = "" // do no cleanup
-		r, err := openRepository(dir)
-		if err != nil {
+		replace := strings.NewReplacer("/", "-", ":", "-")
+		dir = filepath.Join(root, replace.Replace(url))
+
+		// other processes can share the root -> hold the lock of the repository while
+		// it is initialized and fetched
+		if err := os.MkdirAll(root, 0755); err != nil {
 			return nil, err
 		}
-		repo = r
+		// the repository is in use until it is closed, also while it is cloned
+		use, err = useRepository(ctx, dir, lockTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open git repository %q: %w", repoCfg.URL, err)
+		}
+		unlock, err := lockRepository(ctx, dir, lockTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open git repository %q: %w", repoCfg.URL, err)
+		}
+		defer unlock()
+
+		if opts.Cache != nil {
+			// mark the repository in use before it is cloned, such that it is not evicted
+			opts.Cache.acquire(dir)
+			release = dir
+		}
+
+		// check if the directory exists (<init-dir>/<git>/<repo-url w/ replaced / and :>)
+		if fi, err := os.Stat(dir); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+			cleanup = dir
+			r, err := initEmptyRepository(dir)
+			if err != nil {
+				return nil, fmt.Errorf("error cloning git repository %q: %w", repoCfg.URL, err)
+			}
+
+			repo = r
+
+		} else if !fi.IsDir() {
+			// file exists but is not a directory -> corruption
+			return nil, fmt.Errorf("cannot clone git repository %q: %w", repoCfg.URL, err)
+		} else {
+			// director that exists
+			r, err := openRepository(dir)
+			if err == nil {
+				err = verifyRepository(r, url)
+			}
+			if err != nil {
+				// the cache is corrupted -> quarantine it and clone again; it is
+				// moved, which is refused while it is open elsewhere
+				log.FromContext(ctx).Info("cached repository failed verification, re-cloning", "dir", dir, "error", err.Error())
+				if err := withExclusiveUse(ctx, dir, use, func() error {
+					_, err := quarantineRepository(ctx, dir)
+					return err
+				}); err != nil {
+					return nil, fmt.Errorf("cannot quarantine corrupted git repository %q: %w", repoCfg.URL, err)
+				}
+				cleanup = dir
+				r, err = initEmptyRepository(dir)
+				if err != nil {
+					return nil, fmt.Errorf("error cloning git repository %q: %w", repoCfg.URL, err)
+				}
+			}
+			repo = r
+		}
 	}
 
 	// Create Remote
-	if err := initializeOrigin(repo, repoCfg.URL); err != nil {
+	if err := initializeOrigin(repo, url); err != nil {
 		return nil, fmt.Errorf("error cloning git repository %q, cannot create remote: %v", repoCfg.URL, err)
 	}
 
@@ -102,13 +250,31 @@ func OpenRepository(ctx context.Context, root string, repoCfg *configv1alpha1.Gi
 	}
 
 	repository := &gitRepository{
-		url:                repoCfg.URL,
+		url:                url,
+		local:              local,
+		dir:                dir,
 		secret:             repoCfg.Credentials,
+		namespace:          opts.Namespace,
 		ref:                ref,
 		directory:          strings.Trim(repoCfg.Directory, "/"),
 		repo:               repo,
 		credentialResolver: opts.CredentialResolver,
 		userInfoProvider:   opts.UserInfoProvider,
+		committer:          getCommitter(opts.Committer),
+		signer:             opts.Signer,
+		trustPolicy:        opts.TrustPolicy,
+		retryPolicy:        DefaultRetryPolicy,
+		fetchTimeout:       opts.FetchTimeout,
+		pushTimeout:        opts.PushTimeout,
+		lockTimeout:        lockTimeout,
+		cache:              opts.Cache,
+		use:                use,
+	}
+	if opts.RetryPolicy != nil {
+		repository.retryPolicy = *opts.RetryPolicy
+	}
+	if repository.lfs, err = repository.newLFSClient(opts.LFS); err != nil {
+		return nil, fmt.Errorf("invalid lfs configuration of git repository %q: %w", repoCfg.URL, err)
 	}
 
 	if err := repository.fetchRemoteRepository(ctx); err != nil {
@@ -120,26 +286,67 @@ func OpenRepository(ctx context.Context, root string, repoCfg *configv1alpha1.Gi
 	}
 
 	cleanup = "" // success we are good to go w/o removing the directory
+	release = ""
+	use = nil
 
 	return repository, nil
 }
 
+// getCommitter returns the committer identity, using the defaults for
+// the fields that are not provided.
+func getCommitter(ui *auth.UserInfo) auth.UserInfo {
+	committer := auth.UserInfo{
+		Name:  defaultCommitSignatureName,
+		Email: defaultCommitSignatureEmail,
+	}
+	if ui != nil {
+		if ui.Name != "" {
+			committer.Name = ui.Name
+		}
+		if ui.Email != "" {
+			committer.Email = ui.Email
+		}
+	}
+	return committer
+}
+
 func (r *gitRepository) fetchRemoteRepository(ctx context.Context) error {
 	ctx, span := tracer.Start(ctx, "gitRepository::fetchRemoteRepository", trace.WithAttributes())
 	defer span.End()
 
+	if r.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.fetchTimeout)
+		defer cancel()
+	}
+
+	// the references updated by the fetch are recorded such that GC can tell
+	// them apart from the local references
+	before, err := r.localRefs()
+	if err != nil {
+		return err
+	}
+
 	// Fetch
 	switch err := r.doGitWithAuth(ctx, func(auth transport.AuthMethod) error {
-		return r.repo.Fetch(&git.FetchOptions{
+		return r.repo.FetchContext(ctx, &git.FetchOptions{
 			RemoteName: OriginName,
 			Auth:       auth,
 		})
 	}); err {
 	case nil: // OK
+		if err := r.recordFetchedRefs(before); err != nil {
+			return fmt.Errorf("cannot record fetched references of repository %q: %w", r.url, err)
+		}
 	case git.NoErrAlreadyUpToDate:
 	case transport.ErrEmptyRemoteRepository:
 
 	default:
+		// references are only updated after the objects are stored, but an
+		// interrupted fetch can leave temporary pack files behind
+		if cerr := r.cleanupTempObjects(); cerr != nil {
+			log.FromContext(ctx).Error("cannot cleanup temporary objects", "error", cerr)
+		}
 		return fmt.Errorf("cannot fetch repository %q: %w", r.url, err)
 	}
 
@@ -148,26 +355,53 @@ func (r *gitRepository) fetchRemoteRepository(ctx context.Context) error {
 
 // doGitWithAuth fetches auth information for git and provides it
 // to the provided function which performs the operation against a git repo.
+// Authentication failures are retried once with refreshed credentials; transient
+// and rate limited errors are retried with backoff according to the retry policy.
+// Errors are returned as classified RemoteErrors.
 func (r *gitRepository) doGitWithAuth(ctx context.Context, op func(transport.AuthMethod) error) error {
 	log := log.FromContext(ctx)
 	auth, err := r.getAuthMethod(ctx, false)
 	if err != nil {
-		return fmt.Errorf("failed to obtain git credentials: %w", err)
+		return &RemoteError{Class: ErrorClassAuth, Err: fmt.Errorf("failed to obtain git credentials: %w", err)}
 	}
-	err = op(auth)
-	if err != nil {
-		if !errors.Is(err, transport.ErrAuthenticationRequired) {
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		err = op(auth)
+		switch err {
+		case nil, git.NoErrAlreadyUpToDate, transport.ErrEmptyRemoteRepository:
 			return err
 		}
-		log.Info("Authentication failed. Trying to refresh credentials")
-		// TODO: Consider having some kind of backoff here.
-		auth, err := r.getAuthMethod(ctx, true)
-		if err != nil {
-			return fmt.Errorf("failed to obtain git credentials: %w", err)
+		// the transport does not always wrap the error of a cancelled or
+		// expired context, e.g. a stalled push
+		if cerr := ctx.Err(); cerr != nil && !errors.Is(err, cerr) {
+			err = fmt.Errorf("%w: %v", cerr, err)
+		}
+		// the error can wrap a RemoteError classified by the operation
+		classified := classifyError(err)
+		var rerr *RemoteError
+		if !errors.As(classified, &rerr) {
+			return classified
+		}
+
+		if rerr.Class == ErrorClassAuth && errors.Is(err, transport.ErrAuthenticationRequired) && !refreshed {
+			log.Info("Authentication failed. Trying to refresh credentials")
+			refreshed = true
+			auth, err = r.getAuthMethod(ctx, true)
+			if err != nil {
+				return &RemoteError{Class: ErrorClassAuth, Err: fmt.Errorf("failed to obtain git credentials: %w", err)}
+			}
+			attempt--
+			continue
+		}
+		if !rerr.Retryable() || attempt >= r.retryPolicy.MaxAttempts {
+			return classified
+		}
+		backoff := r.retryPolicy.backoff(attempt, rerr.Class)
+		log.Info("git operation failed, retrying", "class", rerr.Class, "attempt", attempt, "backoff", backoff.String(), "error", err.Error())
+		if err := wait(ctx, backoff); err != nil {
+			return classified
 		}
-		return op(auth)
 	}
-	return nil
 }
 
 // getAuthMethod fetches the credentials for authenticating to git. It caches the
@@ -180,9 +414,15 @@ func (r *gitRepository) getAuthMethod(ctx context.Context, forceRefresh bool) (t
 		}
 	*/
 
+	if r.local || r.credentialResolver == nil {
+		return nil, nil
+	}
+
+	r.credentialMu.Lock()
+	defer r.credentialMu.Unlock()
 	if r.credential == nil || !r.credential.Valid() || forceRefresh {
-		if cred, err := r.credentialResolver.ResolveCredential(ctx, "", ""); err != nil {
-			return nil, fmt.Errorf("failed to obtain credential from secret %s/%s: %w", "", "", err)
+		if cred, err := r.credentialResolver.ResolveCredential(ctx, r.namespace, r.secret); err != nil {
+			return nil, fmt.Errorf("failed to obtain credential from secret %s/%s: %w", r.namespace, r.secret, err)
 		} else {
 			r.credential = cred
 		}
@@ -215,6 +455,29 @@ func (r *gitRepository) getCommit(ctx context.Context, ref RefName) (*object.Com
 	return commit, nil
 }
 
+// resolveCommit resolves a revision to a commit. The revision can be a
+// relative ref name (branch or tag), a full reference name (refs/...) or a
+// commit hash.
+func (r *gitRepository) resolveCommit(ctx context.Context, rev string) (*object.Commit, error) {
+	if strings.HasPrefix(rev, "refs/") {
+		ref, err := r.repo.Reference(plumbing.ReferenceName(rev), true)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve reference %q: %w", rev, err)
+		}
+		if tag, err := r.repo.TagObject(ref.Hash()); err == nil {
+			return tag.Commit()
+		}
+		return r.repo.CommitObject(ref.Hash())
+	}
+	if _, err := r.verifyRef(ctx, RefName(rev)); err == nil {
+		return r.getCommit(ctx, RefName(rev))
+	}
+	if plumbing.IsHash(rev) {
+		return r.repo.CommitObject(plumbing.NewHash(rev))
+	}
+	return nil, fmt.Errorf("no branches/tags/commits found for this revision %q: %w", rev, plumbing.ErrReferenceNotFound)
+}
+
 // Verifies reference in the repository and returns true if it is a branch and false
 // if it is a tag or an error if not found
 func (r *gitRepository) verifyRef(ctx context.Context, ref RefName) (bool, error) {
@@ -224,7 +487,7 @@ func (r *gitRepository) verifyRef(ctx context.Context, ref RefName) (bool, error
 	if _, err := r.repo.Reference(ref.TagInLocal(), false); err == nil {
 		return false, nil
 	}
-	return false, fmt.Errorf("no branches/tags found for this ref %q", ref)
+	return false, fmt.Errorf("no branches/tags found for this ref %q: %w", ref, plumbing.ErrReferenceNotFound)
 }
 
 func (r *gitRepository) getCommitFromBranch(ctx context.Context, refname plumbing.ReferenceName) (*object.Commit, error) {
@@ -242,6 +505,10 @@ func (r *gitRepository) getCommitFromTag(ctx context.Context, refname plumbing.R
 	}
 	tag, err := r.repo.TagObject(ref.Hash())
 	if err != nil {
+		if err == plumbing.ErrObjectNotFound {
+			// lightweight tag
+			return r.repo.CommitObject(ref.Hash())
+		}
 		return nil, err
 	}
 
@@ -272,13 +539,21 @@ func (r *gitRepository) pushAndCleanup(ctx context.Context, ph *pushRefSpecBuild
 		return err
 	}
 
+	if r.pushTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.pushTimeout)
+		defer cancel()
+	}
+
 	if err := r.doGitWithAuth(ctx, func(auth transport.AuthMethod) error {
-		return r.repo.Push(&git.PushOptions{
+		return r.repo.PushContext(ctx, &git.PushOptions{
 			RemoteName:        OriginName, // origin
-			RefSpecs:          specs, // e.g. [d48aaa68deca311768be2bb5dd0cd97b8da13971:refs/heads/test-package/test-workspace]
+			RefSpecs:          specs,      // e.g. [d48aaa68deca311768be2bb5dd0cd97b8da13971:refs/heads/test-package/test-workspace]
 			Auth:              auth,
 			RequireRemoteRefs: require, // empty for push
-			Force: true,
+			// updates that are not fast-forward are rejected and reported as
+			// conflicts (ErrConflict) for the caller to resolve
+			Force: false,
 		})
 	}); err != nil {
 		return err
@@ -6,147 +6,351 @@ import (
 	"fmt"
 	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/henderiw/logger/log"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// ListFunc is called with the root tree of the directory of the repository in
+// the commit of the ref. It runs without the lock of the repository, so it can
+// take long and call other operations of the repository, except GC and Repair
+// which wait for it to return.
 type ListFunc func(ctx context.Context, tree *object.Tree) error
 
-func (r *gitRepository) List(ctx context.Context, ref string, listFn ListFunc) error {
+// List calls listFn with the tree of the commit the ref resolves to and returns
+// that commit. The ref can move between a Resolve and a List when the repository
+// is fetched; the returned commit is the one that was listed.
+func (r *gitRepository) List(ctx context.Context, ref string, listFn ListFunc) (*RefInfo, error) {
 	ctx, span := tracer.Start(ctx, "gitRepository::List", trace.WithAttributes())
 	defer span.End()
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	log := log.FromContext(ctx)
-	// getCommit
-	commit, err := r.getCommit(ctx, RefName(ref))
-	if err != nil {
-		return err
-	}
-	tree, err := r.getRootTree(ctx, commit)
+	// the tree is walked from the moment it is resolved
+	defer r.walks.startWalk()()
+	info, tree, err := r.getListTree(ctx, ref)
 	if err != nil {
 		if err == object.ErrDirectoryNotFound {
-			log.Info("could not find directory prefix in commit", "path", r.directory, "commit", commit.Hash.String())
-			return nil
+			log.Info("could not find directory prefix in commit", "path", r.directory, "ref", ref)
+			return info, nil
 		} else {
-			return err
+			return nil, err
 		}
 	}
+	// the tree of the commit is immutable -> it is walked without the lock,
+	// such that a long listFn does not block commits, pushes and fetches
 	if listFn != nil {
-		return listFn(ctx, tree)
+		if err := listFn(ctx, tree); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return info, nil
 }
 
-func (r *gitRepository) Commit(ctx context.Context, ref, packageName, workspaceName, revision string, resources map[string]string) error {
+// getListTree resolves the ref to the commit and the root tree of the
+// directory of the repository under the read lock
+func (r *gitRepository) getListTree(ctx context.Context, ref string) (*RefInfo, *object.Tree, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	commit, signer, err := r.getVerifiedCommit(ctx, RefName(ref))
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &RefInfo{Commit: commit.Hash, Signer: signer}
+	tree, err := r.getRootTree(ctx, commit)
+	if err != nil {
+		return info, nil, err
+	}
+	return info, tree, nil
+}
+
+// RefInfo describes the commit a ref resolves to
+type RefInfo struct {
+	// Commit is the commit the ref points to
+	Commit plumbing.Hash
+	// Signer is the verified signer of the tag or commit; only set when the
+	// repository has a trust policy
+	Signer string
+}
+
+// Resolve returns the commit the ref points to, verified with the trust policy
+// of the repository in the same way as List.
+func (r *gitRepository) Resolve(ctx context.Context, ref string) (*RefInfo, error) {
+	ctx, span := tracer.Start(ctx, "gitRepository::Resolve", trace.WithAttributes())
+	defer span.End()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	commit, signer, err := r.getVerifiedCommit(ctx, RefName(ref))
+	if err != nil {
+		return nil, err
+	}
+	return &RefInfo{Commit: commit.Hash, Signer: signer}, nil
+}
+
+// CommitOptions holds the optional configuration of a commit
+type CommitOptions struct {
+	// Message is the commit message; defaults to "Intermediate commit"
+	Message string
+	// Task is the structured record of the change, stored in the commit annotation
+	Task *Task
+	// Trailers are added at the end of the commit message (e.g. Signed-off-by, Change-Id)
+	Trailers []Trailer
+	// Modes holds the file mode of the files, keyed like the files;
+	// defaults to filemode.Regular. The content of a filemode.Symlink resource
+	// is the relative target of the symlink.
+	Modes map[string]filemode.FileMode
+	// DryRun computes the commit without updating the reference; the objects
+	// of the commit are stored but unreferenced and removed by GC
+	DryRun bool
+}
+
+// CommitResult describes the commit created by Commit
+type CommitResult struct {
+	// Ref is the reference the commit is made on
+	Ref string
+	// Parent is the commit the commit is based on: the current commit of the
+	// reference or, when the reference does not exist, the main branch
+	Parent plumbing.Hash
+	// Commit is the created commit
+	Commit plumbing.Hash
+	// Tree is the root tree of the commit
+	Tree plumbing.Hash
+	// PackageTree is the tree of the package directory
+	PackageTree plumbing.Hash
+	// UpdatedRefs holds the references updated by the commit; empty for a dry run
+	UpdatedRefs []string
+	// Changes holds the files added, modified or deleted by the commit, relative
+	// to the directory of the repository and sorted by path
+	Changes []FileChange
+	// DryRun indicates the reference was not updated
+	DryRun bool
+}
+
+// Commit replaces the files of the package with the resources in a commit on
+// the ref. A ref that does not exist is created from the main branch.
+func (r *gitRepository) Commit(ctx context.Context, ref, packageName, workspaceName, revision string, resources map[string]string, opts *CommitOptions) (*CommitResult, error) {
+	files := make(map[string]Content, len(resources))
+	for k, v := range resources {
+		files[k] = StringContent(v)
+	}
+	return r.CommitFiles(ctx, ref, packageName, workspaceName, revision, files, opts)
+}
+
+// CommitFiles is Commit with the content of the files streamed into the blobs,
+// such that binary and large files need not be held in memory.
+func (r *gitRepository) CommitFiles(ctx context.Context, ref, packageName, workspaceName, revision string, files map[string]Content, opts *CommitOptions) (*CommitResult, error) {
 	ctx, span := tracer.Start(ctx, "gitRepository::Create", trace.WithAttributes())
 	defer span.End()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// check if the new ref already exists
+	log := log.FromContext(ctx)
+	if opts == nil {
+		opts = &CommitOptions{}
+	}
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	var parentCommit *object.Commit
 	if _, err := r.repo.Reference(plumbing.ReferenceName(ref), false); err != nil {
-		fmt.Println("Create from base")
+		if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return nil, err
+		}
 		// create -> ref does no exist
 		// get the main ref of the repository -> typically main
 		parentCommit, err = r.getCommit(ctx, r.ref)
 		if err != nil {
 			// We dont support empty repositories
-			return err
-		}
-		localRef := plumbing.NewHashReference(plumbing.ReferenceName(ref), parentCommit.Hash)
-		if err := r.repo.Storer.SetReference(localRef); err != nil {
-			return err
+			return nil, err
 		}
-
 	} else {
-		fmt.Println("Update reference")
 		// update -> ref already exists
 		parentCommit, err = r.getCommitFromBranch(ctx, plumbing.ReferenceName(ref))
 		if err != nil {
 			// Strange
-			return err
+			return nil, err
 		}
 	}
 	packagePath := filepath.Join(r.directory, packageName)
 	ch, err := newCommitHelper(ctx, r, parentCommit.Hash, packagePath, plumbing.ZeroHash)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	for k, v := range resources {
-		ch.storeFile(path.Join(packagePath, k), v)
+	for k, v := range files {
+		mode, ok := opts.Modes[k]
+		if !ok {
+			mode = filemode.Regular
+		}
+		if err := ch.storeFileWithMode(path.Join(packagePath, k), v, mode); err != nil {
+			return nil, fmt.Errorf("cannot store file %q: %w", k, err)
+		}
 	}
 
 	annotation := &gitAnnotation{
 		PackagePath:   packagePath,
 		WorkspaceName: workspaceName,
 		Revision:      revision,
-		//Task:          change,
+		Task:          opts.Task,
 	}
-	message := "Intermediate commit"
-	/*
-		if change != nil {
-			message += fmt.Sprintf(": %s", change.Type)
-			draft.tasks = append(draft.tasks, *change)
+	message := opts.Message
+	if message == "" {
+		message = "Intermediate commit"
+		if opts.Task != nil {
+			message += fmt.Sprintf(": %s", opts.Task.Type)
 		}
-	*/
-	message += "\n"
+	}
+	message = strings.TrimRight(message, "\n") + "\n"
 	message, err = AnnotateCommitMessage(message, annotation)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	message, err = AddCommitTrailers(message, opts.Trailers)
+	if err != nil {
+		return nil, err
 	}
 
 	commitHash, packageTree, err := ch.commit(ctx, message, packagePath)
 	if err != nil {
-		return fmt.Errorf("failed to commit package: %w", err)
+		return nil, fmt.Errorf("failed to commit package: %w", err)
+	}
+	commit, err := r.repo.CommitObject(commitHash)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := r.diffCommits(ctx, parentCommit, commit, &DiffOptions{})
+	if err != nil {
+		return nil, err
+	}
+	result := &CommitResult{
+		Ref:         ref,
+		Parent:      parentCommit.Hash,
+		Commit:      commitHash,
+		Tree:        commit.TreeHash,
+		PackageTree: packageTree,
+		UpdatedRefs: []string{},
+		Changes:     changes,
+		DryRun:      opts.DryRun,
 	}
-	fmt.Println("commitHash", commitHash)
-	fmt.Println("packageTree", packageTree)
 
-	localRef := plumbing.NewHashReference(plumbing.ReferenceName(ref), commitHash)
-	fmt.Println("localRef", localRef)
-	if err := r.repo.Storer.SetReference(localRef); err != nil {
-		return err
+	if !opts.DryRun {
+		localRef := plumbing.NewHashReference(plumbing.ReferenceName(ref), commitHash)
+		if err := r.repo.Storer.SetReference(localRef); err != nil {
+			return nil, err
+		}
+		result.UpdatedRefs = append(result.UpdatedRefs, ref)
 	}
-	fmt.Println("Commit", nil)
+	log.Debug("commit", "ref", ref, "commit", commitHash.String(), "parent", parentCommit.Hash.String(), "changes", len(changes), "dryRun", opts.DryRun)
+	return result, nil
+}
 
-	return nil
+// PushOptions holds the optional configuration of a push
+type PushOptions struct {
+	// DryRun computes the refspecs without pushing
+	DryRun bool
+}
+
+// PushResult describes the outcome of Push
+type PushResult struct {
+	// Ref is the local reference that is pushed
+	Ref string
+	// Commit is the commit that is pushed
+	Commit plumbing.Hash
+	// RefSpecs holds the refspecs sent to the remote, sorted
+	RefSpecs []string
+	// UpdatedRefs holds the remote references updated by the push; empty when
+	// the remote was up to date or for a dry run
+	UpdatedRefs []string
+	// UpToDate indicates the remote references already pointed to the commit
+	UpToDate bool
+	// DryRun indicates nothing was pushed
+	DryRun bool
 }
 
-func (r *gitRepository) Push(ctx context.Context, ref string) error {
+// Push pushes the commit of the local ref to the corresponding remote branch
+func (r *gitRepository) Push(ctx context.Context, ref string, opts *PushOptions) (*PushResult, error) {
 	ctx, span := tracer.Start(ctx, "gitRepository::Push", trace.WithAttributes())
 	defer span.End()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if opts == nil {
+		opts = &PushOptions{}
+	}
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	refSpecs := newPushRefSpecBuilder()
 
 	// Find the local reference -> to find out if it exists
 	localref, err := r.repo.Reference(plumbing.ReferenceName(ref), false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Get the commit hash related to the reference
 	commit, err := r.getCommitFromBranch(ctx, plumbing.ReferenceName(ref))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// build the refs to push to the remote reference
 	refSpecs.AddRefToPush(localref.Name(), commit.Hash)
+	result := &PushResult{
+		Ref:    ref,
+		Commit: commit.Hash,
+		DryRun: opts.DryRun,
+	}
+	if err := r.push(ctx, refSpecs, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// push pushes the refs and records the refspecs and the outcome in the result;
+// nothing is pushed for a dry run
+func (r *gitRepository) push(ctx context.Context, refSpecs *pushRefSpecBuilder, result *PushResult) error {
+	log := log.FromContext(ctx)
+	specs, _, err := refSpecs.BuildRefSpecs()
+	if err != nil {
+		return err
+	}
+	result.RefSpecs = make([]string, 0, len(specs))
+	result.UpdatedRefs = []string{}
+	for _, spec := range specs {
+		result.RefSpecs = append(result.RefSpecs, spec.String())
+	}
+	sort.Strings(result.RefSpecs)
+	if result.DryRun {
+		log.Debug("push", "ref", result.Ref, "commit", result.Commit.String(), "refSpecs", result.RefSpecs, "dryRun", true)
+		return nil
+	}
+
 	if err := r.pushAndCleanup(ctx, refSpecs); err != nil {
 		if !errors.Is(err, git.NoErrAlreadyUpToDate) {
 			return err
 		}
+		result.UpToDate = true
+	} else {
+		for _, spec := range specs {
+			result.UpdatedRefs = append(result.UpdatedRefs, spec.Dst("").String())
+		}
+		sort.Strings(result.UpdatedRefs)
 	}
-
+	log.Debug("push", "ref", result.Ref, "commit", result.Commit.String(), "refSpecs", result.RefSpecs, "upToDate", result.UpToDate)
 	return nil
 }
@@ -0,0 +1,200 @@
+package gittest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/henderiw/git-loader/pkg/git"
+)
+
+// StressOptions holds the configuration of a concurrent run against a repository
+type StressOptions struct {
+	// Readers is the number of concurrent readers; defaults to 8
+	Readers int
+	// Writers is the number of concurrent writers; defaults to 2
+	Writers int
+	// Maintainers is the number of concurrent maintainers; defaults to 1
+	Maintainers int
+	// Iterations is the number of operations per reader, writer and maintainer;
+	// defaults to 10
+	Iterations int
+	// Ref is the reference the readers list and diff; defaults to main
+	Ref string
+	// PackageName is the package the writers commit to; defaults to stress
+	PackageName string
+	// Push pushes the workspace of the writers after every commit
+	Push bool
+}
+
+// Stress runs readers (List reading every file, Diff and Verify) concurrently
+// with writers (Commit and optionally Push) and maintainers (GC, Repair and
+// Merge) against the repository. It is meant to be run with the race detector
+// enabled, e.g. go test -race -run TestStress ./pkg/git
+func Stress(ctx context.Context, repo git.GitRepository, opts *StressOptions) error {
+	if opts == nil {
+		opts = &StressOptions{}
+	}
+	readers := defaultInt(opts.Readers, 8)
+	writers := defaultInt(opts.Writers, 2)
+	maintainers := defaultInt(opts.Maintainers, 1)
+	iterations := defaultInt(opts.Iterations, 10)
+	ref := opts.Ref
+	if ref == "" {
+		ref = string(git.MainBranch)
+	}
+	packageName := opts.PackageName
+	if packageName == "" {
+		packageName = "stress"
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	report := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	// Repair discards the commits that were not pushed, so it does not run
+	// between the commit of a writer and its push
+	var repairMu sync.RWMutex
+
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < iterations; n++ {
+				if err := read(ctx, repo, ref, n); err != nil {
+					report(fmt.Errorf("reader %d: %w", i, err))
+					return
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			workspace := fmt.Sprintf("ws%d", i)
+			workspaceRef := fmt.Sprintf("refs/remotes/%s/%s/%s", git.OriginName, packageName, workspace)
+			for n := 0; n < iterations; n++ {
+				resources := map[string]string{
+					fmt.Sprintf("%s/file%d.yaml", workspace, n): fmt.Sprintf("iteration: %d\n", n),
+				}
+				if err := write(ctx, repo, &repairMu, workspaceRef, packageName, workspace, resources, opts.Push); err != nil {
+					report(fmt.Errorf("writer %d: %w", i, err))
+					return
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < maintainers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			workspace := fmt.Sprintf("maintainer%d", i)
+			workspaceRef := fmt.Sprintf("refs/remotes/%s/%s/%s", git.OriginName, packageName, workspace)
+			for n := 0; n < iterations; n++ {
+				if err := maintain(ctx, repo, &repairMu, workspaceRef, packageName, workspace, n); err != nil {
+					report(fmt.Errorf("maintainer %d: %w", i, err))
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// read performs one of the read operations
+func read(ctx context.Context, repo git.GitRepository, ref string, n int) error {
+	switch n % 3 {
+	case 0:
+		if _, err := repo.List(ctx, ref, func(ctx context.Context, tree *object.Tree) error {
+			return readTree(tree)
+		}); err != nil {
+			return fmt.Errorf("list: %w", err)
+		}
+	case 1:
+		if _, err := repo.Diff(ctx, ref, ref, &git.DiffOptions{Patch: true}); err != nil {
+			return fmt.Errorf("diff: %w", err)
+		}
+	default:
+		if err := repo.Verify(ctx); err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+	}
+	return nil
+}
+
+// write commits the resources on the workspace and optionally pushes it
+func write(ctx context.Context, repo git.GitRepository, repairMu *sync.RWMutex, workspaceRef, packageName, workspace string, resources map[string]string, push bool) error {
+	repairMu.RLock()
+	defer repairMu.RUnlock()
+	if _, err := repo.Commit(ctx, workspaceRef, packageName, workspace, "v1", resources, nil); err != nil {
+		return err
+	}
+	if push {
+		if _, err := repo.Push(ctx, workspaceRef, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maintain performs one of the maintenance operations; the workspace of the
+// maintainer is committed before it is merged as Repair discards it
+func maintain(ctx context.Context, repo git.GitRepository, repairMu *sync.RWMutex, workspaceRef, packageName, workspace string, n int) error {
+	switch n % 3 {
+	case 0:
+		if _, err := repo.GC(ctx, nil); err != nil {
+			return fmt.Errorf("gc: %w", err)
+		}
+	case 1:
+		repairMu.Lock()
+		defer repairMu.Unlock()
+		if err := repo.Repair(ctx); err != nil {
+			return fmt.Errorf("repair: %w", err)
+		}
+	default:
+		resources := map[string]string{
+			fmt.Sprintf("%s/file%d.yaml", workspace, n): fmt.Sprintf("iteration: %d\n", n),
+		}
+		if _, err := repo.Commit(ctx, workspaceRef, packageName, workspace, "v1", resources, nil); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		res, err := repo.Merge(ctx, workspaceRef, packageName)
+		if err != nil {
+			return fmt.Errorf("merge: %w", err)
+		}
+		if len(res.Conflicts) > 0 {
+			return fmt.Errorf("merge: %d conflicts", len(res.Conflicts))
+		}
+	}
+	return nil
+}
+
+// readTree reads the content of every file in the tree
+func readTree(tree *object.Tree) error {
+	return tree.Files().ForEach(func(f *object.File) error {
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(io.Discard, r)
+		return err
+	})
+}
+
+func defaultInt(v, d int) int {
+	if v <= 0 {
+		return d
+	}
+	return v
+}
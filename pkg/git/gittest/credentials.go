@@ -0,0 +1,71 @@
+package gittest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/henderiw/git-loader/pkg/auth"
+)
+
+// CredentialResolver resolves static basic auth credentials that can be changed
+// to exercise credential refreshes.
+type CredentialResolver struct {
+	m        sync.Mutex
+	username string
+	password string
+	// resolved counts the number of times the credentials were resolved
+	resolved int
+}
+
+var _ auth.CredentialResolver = &CredentialResolver{}
+
+// NewCredentialResolver returns a credential resolver for the basic auth credentials
+func NewCredentialResolver(username, password string) *CredentialResolver {
+	return &CredentialResolver{
+		username: username,
+		password: password,
+	}
+}
+
+// SetCredentials changes the credentials returned on the next resolution
+func (r *CredentialResolver) SetCredentials(username, password string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.username = username
+	r.password = password
+}
+
+// Resolved returns the number of times the credentials were resolved
+func (r *CredentialResolver) Resolved() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.resolved
+}
+
+func (r *CredentialResolver) ResolveCredential(ctx context.Context, namespace, name string) (auth.Credential, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.resolved++
+	return &credential{
+		username: r.username,
+		password: r.password,
+	}, nil
+}
+
+type credential struct {
+	username string
+	password string
+}
+
+func (r *credential) Valid() bool {
+	return true
+}
+
+func (r *credential) ToAuthMethod() transport.AuthMethod {
+	return &http.BasicAuth{
+		Username: r.username,
+		Password: r.password,
+	}
+}
@@ -0,0 +1,88 @@
+package gittest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/henderiw/git-loader/pkg/git/lfs"
+)
+
+// The server serves a Git LFS stand-in at <URL>/<name>.git/info/lfs, the default
+// LFS endpoint of the repositories, with the credentials of the git server.
+const lfsPath = ".git/info/lfs/"
+
+// Service names of the LFS requests, as counted by Requests
+const (
+	LFSBatchService    = "lfs-batch"
+	LFSDownloadService = "lfs-download"
+)
+
+// AddLFSObject stores the content as LFS object of the repository and returns
+// the pointer file to commit in its place.
+func (r *Server) AddLFSObject(name string, content []byte) string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	name = strings.Trim(name, "/")
+	if r.lfsObjects == nil {
+		r.lfsObjects = map[string]map[string][]byte{}
+	}
+	if r.lfsObjects[name] == nil {
+		r.lfsObjects[name] = map[string][]byte{}
+	}
+	p := lfs.NewPointer(content)
+	r.lfsObjects[name][p.Oid] = append([]byte{}, content...)
+	return p.String()
+}
+
+type lfsBatchRequest struct {
+	Operation string `json:"operation"`
+	Objects   []struct {
+		Oid  string `json:"oid"`
+		Size int64  `json:"size"`
+	} `json:"objects"`
+}
+
+// serveLFS serves the batch API and the downloads of the objects of the
+// repository; it is called with the lock held.
+func (r *Server) serveLFS(w http.ResponseWriter, req *http.Request, name, p string) {
+	objects := r.lfsObjects[name]
+	switch {
+	case req.Method == http.MethodPost && p == "objects/batch":
+		br := &lfsBatchRequest{}
+		if err := json.NewDecoder(req.Body).Decode(br); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if br.Operation != "download" {
+			http.Error(w, "only downloads are supported", http.StatusNotImplemented)
+			return
+		}
+		resp := map[string]any{}
+		var objs []map[string]any
+		for _, o := range br.Objects {
+			obj := map[string]any{"oid": o.Oid, "size": o.Size}
+			if content, ok := objects[o.Oid]; ok && int64(len(content)) == o.Size {
+				obj["actions"] = map[string]any{
+					"download": map[string]any{"href": r.URL + "/" + name + lfsPath + "objects/" + o.Oid},
+				}
+			} else {
+				obj["error"] = map[string]any{"code": http.StatusNotFound, "message": "object not found"}
+			}
+			objs = append(objs, obj)
+		}
+		resp["objects"] = objs
+		w.Header().Set("Content-Type", "application/vnd.git-lfs+json")
+		json.NewEncoder(w).Encode(resp)
+	case req.Method == http.MethodGet && strings.HasPrefix(p, "objects/"):
+		content, ok := objects[strings.TrimPrefix(p, "objects/")]
+		if !ok {
+			http.Error(w, "object not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(content)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,193 @@
+package gittest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/henderiw/git-loader/pkg/sign"
+)
+
+var signature = object.Signature{
+	Name:  "gittest",
+	Email: "gittest@localhost",
+}
+
+// CommitFiles commits a snapshot of the files (path -> content) on the branch of
+// the repository. The files replace the complete tree of the parent commit.
+func CommitFiles(repo *git.Repository, branch string, files map[string]string, message string) (plumbing.Hash, error) {
+	return commitFiles(repo, branch, files, message, nil)
+}
+
+// CommitSignedFiles is like CommitFiles and signs the commit with the signer.
+func CommitSignedFiles(repo *git.Repository, branch string, files map[string]string, message string, signer sign.Signer) (plumbing.Hash, error) {
+	return commitFiles(repo, branch, files, message, signer)
+}
+
+func commitFiles(repo *git.Repository, branch string, files map[string]string, message string, signer sign.Signer) (plumbing.Hash, error) {
+	treeHash, err := storeTree(repo.Storer, files)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	refName := plumbing.NewBranchReferenceName(branch)
+	sig := signature
+	sig.When = time.Now()
+	commit := &object.Commit{
+		Author:    sig,
+		Committer: sig,
+		Message:   message,
+		TreeHash:  treeHash,
+	}
+	if ref, err := repo.Storer.Reference(refName); err == nil {
+		commit.ParentHashes = []plumbing.Hash{ref.Hash()}
+	}
+	if signer != nil {
+		eo := &plumbing.MemoryObject{}
+		if err := commit.EncodeWithoutSignature(eo); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		signed, err := signObject(eo, signer)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("cannot sign commit: %w", err)
+		}
+		commit.PGPSignature = string(signed)
+	}
+
+	hash, err := storeObject(repo.Storer, commit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(refName, hash)); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return hash, nil
+}
+
+// CreateTag creates a tag pointing to the commit hash; an annotated tag object is
+// created when annotated is true, otherwise a lightweight tag.
+func CreateTag(repo *git.Repository, name string, hash plumbing.Hash, annotated bool) error {
+	if !annotated {
+		return repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(name), hash))
+	}
+	_, err := repo.CreateTag(name, hash, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: signature.Name, Email: signature.Email, When: time.Now()},
+		Message: name,
+	})
+	return err
+}
+
+// CreateSignedTag creates an annotated tag pointing to the commit hash, signed
+// with the signer.
+func CreateSignedTag(repo *git.Repository, name string, hash plumbing.Hash, signer sign.Signer) error {
+	sig := signature
+	sig.When = time.Now()
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     sig,
+		Message:    name + "\n",
+		TargetType: plumbing.CommitObject,
+		Target:     hash,
+	}
+	eo := &plumbing.MemoryObject{}
+	if err := tag.EncodeWithoutSignature(eo); err != nil {
+		return err
+	}
+	signed, err := signObject(eo, signer)
+	if err != nil {
+		return fmt.Errorf("cannot sign tag %s: %w", name, err)
+	}
+	tag.PGPSignature = string(signed)
+	tagHash, err := storeObject(repo.Storer, tag)
+	if err != nil {
+		return err
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(name), tagHash))
+}
+
+// signObject signs the encoded (unsigned) commit or tag
+func signObject(eo plumbing.EncodedObject, signer sign.Signer) ([]byte, error) {
+	rd, err := eo.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	message, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(message)
+}
+
+type encoder interface {
+	Encode(o plumbing.EncodedObject) error
+}
+
+func storeObject(s storer.EncodedObjectStorer, obj encoder) (plumbing.Hash, error) {
+	eo := s.NewEncodedObject()
+	if err := obj.Encode(eo); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(eo)
+}
+
+// storeTree stores the files as blobs and trees and returns the hash of the root tree
+func storeTree(s storer.EncodedObjectStorer, files map[string]string) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	dirs := map[string]map[string]string{}
+	for p, content := range files {
+		p = strings.Trim(p, "/")
+		dir, rest, found := strings.Cut(p, "/")
+		if found {
+			if _, ok := dirs[dir]; !ok {
+				dirs[dir] = map[string]string{}
+			}
+			dirs[dir][rest] = content
+			continue
+		}
+		eo := s.NewEncodedObject()
+		eo.SetType(plumbing.BlobObject)
+		w, err := eo.Writer()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			w.Close()
+			return plumbing.ZeroHash, err
+		}
+		if err := w.Close(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		hash, err := s.SetEncodedObject(eo)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: p, Mode: filemode.Regular, Hash: hash})
+	}
+	for dir, dirFiles := range dirs {
+		hash, err := storeTree(s, dirFiles)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("cannot store tree %q: %w", dir, err)
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash})
+	}
+	// git sorts tree entries as though directories have '/' appended to them
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return sortKey(tree.Entries[i]) < sortKey(tree.Entries[j])
+	})
+	return storeObject(s, tree)
+}
+
+func sortKey(e object.TreeEntry) string {
+	if e.Mode == filemode.Dir {
+		return e.Name + "/"
+	}
+	return e.Name
+}
@@ -0,0 +1,394 @@
+// Package gittest provides fixtures to exercise the git repository offline.
+package gittest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// ServerOptions holds the configuration of the test git server
+type ServerOptions struct {
+	// Username and Password enable basic authentication on the server
+	Username string
+	Password string
+}
+
+// Server is an in-process smart-HTTP git server serving in-memory bare repositories.
+// Repositories are served at <URL>/<name> and their LFS objects at
+// <URL>/<name>.git/info/lfs.
+type Server struct {
+	// URL is the base URL of the server
+	URL string
+
+	httpServer *httptest.Server
+
+	m        sync.Mutex
+	username string
+	password string
+	repos    map[string]*git.Repository
+	// requests counts the requests per service (e.g. git-upload-pack)
+	requests map[string]int
+	// failures holds the http status codes returned for the next requests
+	failures []int
+	// stalls holds the number of pack transfers to stall per service
+	stalls map[string]int
+	// closed is closed when the server is closed, releasing stalled requests
+	closed chan struct{}
+	// lfsObjects holds the LFS objects per repository, keyed by oid
+	lfsObjects map[string]map[string][]byte
+}
+
+// NewServer starts a test git server; the server must be closed by the caller.
+func NewServer(opts *ServerOptions) *Server {
+	if opts == nil {
+		opts = &ServerOptions{}
+	}
+	s := &Server{
+		username: opts.Username,
+		password: opts.Password,
+		repos:    map[string]*git.Repository{},
+		requests: map[string]int{},
+		stalls:   map[string]int{},
+		closed:   make(chan struct{}),
+	}
+	s.httpServer = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.httpServer.URL
+	return s
+}
+
+// Close shuts down the server
+func (r *Server) Close() {
+	close(r.closed)
+	r.httpServer.Close()
+}
+
+// SetCredentials changes the basic authentication credentials of the server;
+// empty credentials disable authentication.
+func (r *Server) SetCredentials(username, password string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.username = username
+	r.password = password
+}
+
+// InjectFailures makes the server respond with the http status code to the next
+// count requests, e.g. to exercise retries on transient or rate limited errors.
+func (r *Server) InjectFailures(statusCode, count int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for i := 0; i < count; i++ {
+		r.failures = append(r.failures, statusCode)
+	}
+}
+
+// Stall makes the server stall the next count pack transfers of the service
+// (git-upload-pack or git-receive-pack) until the client gives up, e.g. to
+// exercise timeouts: an upload-pack sends half of the pack, a receive-pack
+// updates no reference and sends nothing.
+func (r *Server) Stall(service string, count int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.stalls[service] += count
+}
+
+// Requests returns the number of requests the server received for the service
+// (git-upload-pack, git-receive-pack, lfs-batch or lfs-download), including
+// rejected requests.
+func (r *Server) Requests(service string) int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.requests[service]
+}
+
+// CreateRepository creates an empty repository with main as default branch
+// and returns the URL of the repository.
+func (r *Server) CreateRepository(name string) (*git.Repository, string, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	name = strings.Trim(name, "/")
+	if _, ok := r.repos[name]; ok {
+		return nil, "", fmt.Errorf("repository %q already exists", name)
+	}
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("main"))); err != nil {
+		return nil, "", err
+	}
+	r.repos[name] = repo
+	return repo, r.URL + "/" + name, nil
+}
+
+// Repository returns the repository with the name or nil if it does not exist.
+func (r *Server) Repository(name string) *git.Repository {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.repos[strings.Trim(name, "/")]
+}
+
+func (r *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	// requests are served one at a time as the in-memory storage
+	// is not safe for concurrent use
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var name, service, lfsRequest string
+	switch {
+	case strings.Contains(req.URL.Path, lfsPath):
+		name, lfsRequest, _ = strings.Cut(req.URL.Path, lfsPath)
+		service = LFSBatchService
+		if req.Method == http.MethodGet {
+			service = LFSDownloadService
+		}
+	case req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/info/refs"):
+		name = strings.TrimSuffix(req.URL.Path, "/info/refs")
+		service = req.URL.Query().Get("service")
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/"+transport.UploadPackServiceName):
+		name = strings.TrimSuffix(req.URL.Path, "/"+transport.UploadPackServiceName)
+		service = transport.UploadPackServiceName
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/"+transport.ReceivePackServiceName):
+		name = strings.TrimSuffix(req.URL.Path, "/"+transport.ReceivePackServiceName)
+		service = transport.ReceivePackServiceName
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	r.requests[service]++
+
+	if len(r.failures) != 0 {
+		statusCode := r.failures[0]
+		r.failures = r.failures[1:]
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	if r.username != "" || r.password != "" {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != r.username || password != r.password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gittest"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	repo, ok := r.repos[strings.Trim(name, "/")]
+	if !ok {
+		http.Error(w, "repository not found", http.StatusNotFound)
+		return
+	}
+	if lfsRequest != "" {
+		r.serveLFS(w, req, strings.Trim(name, "/"), lfsRequest)
+		return
+	}
+	if req.Method == http.MethodPost && r.stalls[service] > 0 {
+		r.stalls[service]--
+		r.stall(w, req, repo, service)
+		return
+	}
+
+	var err error
+	switch {
+	case req.Method == http.MethodGet:
+		err = advertiseReferences(req.Context(), w, repo, service)
+	case service == transport.UploadPackServiceName:
+		err = uploadPack(req.Context(), w, req, repo)
+	default:
+		err = receivePack(req.Context(), w, req, repo)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// stall writes half of the response of an upload-pack, or nothing for a
+// receive-pack, and blocks until the client gives up or the server is closed
+func (r *Server) stall(w http.ResponseWriter, req *http.Request, repo *git.Repository, service string) {
+	if service == transport.UploadPackServiceName {
+		rec := httptest.NewRecorder()
+		if err := uploadPack(req.Context(), rec, req, repo); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		body := rec.Body.Bytes()
+		w.Write(body[:len(body)/2])
+		w.(http.Flusher).Flush()
+	} else {
+		// the client disconnecting is only noticed once the request is read
+		io.Copy(io.Discard, req.Body)
+	}
+	select {
+	case <-req.Context().Done():
+	case <-r.closed:
+	}
+}
+
+// storerLoader loads the storer of a single repository, independent of the endpoint
+type storerLoader struct {
+	storer storer.Storer
+}
+
+func (r *storerLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	return r.storer, nil
+}
+
+func newServer(repo *git.Repository) (transport.Transport, *transport.Endpoint, error) {
+	ep, err := transport.NewEndpoint("/")
+	if err != nil {
+		return nil, nil, err
+	}
+	return server.NewServer(&storerLoader{storer: repo.Storer}), ep, nil
+}
+
+func advertiseReferences(ctx context.Context, w http.ResponseWriter, repo *git.Repository, service string) error {
+	srv, ep, err := newServer(repo)
+	if err != nil {
+		return err
+	}
+	var ar *packp.AdvRefs
+	switch service {
+	case transport.UploadPackServiceName:
+		sess, err := srv.NewUploadPackSession(ep, nil)
+		if err != nil {
+			return err
+		}
+		ar, err = sess.AdvertisedReferencesContext(ctx)
+		if err != nil {
+			return err
+		}
+	case transport.ReceivePackServiceName:
+		sess, err := srv.NewReceivePackSession(ep, nil)
+		if err != nil {
+			return err
+		}
+		ar, err = sess.AdvertisedReferencesContext(ctx)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported service %q", service)
+	}
+	ar.Prefix = [][]byte{[]byte("# service=" + service), pktline.Flush}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+	w.Header().Set("Cache-Control", "no-cache")
+	return ar.Encode(w)
+}
+
+func uploadPack(ctx context.Context, w http.ResponseWriter, req *http.Request, repo *git.Repository) error {
+	srv, ep, err := newServer(repo)
+	if err != nil {
+		return err
+	}
+	sess, err := srv.NewUploadPackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+
+	upreq := packp.NewUploadPackRequest()
+	if err := upreq.UploadRequest.Decode(req.Body); err != nil {
+		return fmt.Errorf("cannot decode upload-pack request: %w", err)
+	}
+	// the haves follow the wants until done
+	scanner := pktline.NewScanner(req.Body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if bytes.Equal(line, []byte("done")) {
+			break
+		}
+		if have, ok := bytes.CutPrefix(line, []byte("have ")); ok {
+			// the client can have commits the server does not know, e.g.
+			// unpushed workspaces; like a real server these are ignored
+			hash := plumbing.NewHash(string(have))
+			if repo.Storer.HasEncodedObject(hash) == nil {
+				upreq.Haves = append(upreq.Haves, hash)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot decode upload-pack request: %w", err)
+	}
+
+	resp, err := sess.UploadPack(ctx, upreq)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+	w.Header().Set("Cache-Control", "no-cache")
+	return resp.Encode(w)
+}
+
+func receivePack(ctx context.Context, w http.ResponseWriter, req *http.Request, repo *git.Repository) error {
+	srv, ep, err := newServer(repo)
+	if err != nil {
+		return err
+	}
+	sess, err := srv.NewReceivePackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+
+	updreq := packp.NewReferenceUpdateRequest()
+	if err := updreq.Decode(req.Body); err != nil {
+		return fmt.Errorf("cannot decode receive-pack request: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// reject updates of references that changed since they were advertised,
+	// like a real server does for concurrent pushes
+	if rs := rejectStaleUpdates(repo, updreq); rs != nil {
+		return rs.Encode(w)
+	}
+
+	rs, err := sess.ReceivePack(ctx, updreq)
+	if rs != nil {
+		return rs.Encode(w)
+	}
+	return err
+}
+
+func rejectStaleUpdates(repo *git.Repository, updreq *packp.ReferenceUpdateRequest) *packp.ReportStatus {
+	rs := packp.NewReportStatus()
+	rs.UnpackStatus = "ok"
+	stale := false
+	for _, cmd := range updreq.Commands {
+		current := plumbing.ZeroHash
+		if ref, err := repo.Storer.Reference(cmd.Name); err == nil {
+			current = ref.Hash()
+		}
+		status := &packp.CommandStatus{ReferenceName: cmd.Name, Status: "ok"}
+		if current != cmd.Old {
+			status.Status = "fetch first"
+			stale = true
+		}
+		rs.CommandStatuses = append(rs.CommandStatuses, status)
+	}
+	if !stale {
+		return nil
+	}
+	if updreq.Packfile != nil {
+		updreq.Packfile.Close()
+	}
+	return rs
+}
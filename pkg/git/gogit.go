@@ -1,18 +1,42 @@
 package git
 
 import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
 // initEmptyRepository initializes an empty bare repository
 func initEmptyRepository(path string) (*git.Repository, error) {
-	isBare := true 
-	repo, err := git.PlainInit(path, isBare)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	repo, err := git.Init(newSyncStorage(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := initializeDefaultBranches(repo); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// initMemoryRepository initializes an empty repository backed by in-memory storage
+func initMemoryRepository() (*git.Repository, error) {
+	repo, err := git.Init(newSyncMemoryStorage(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -37,9 +61,7 @@ func initializeDefaultBranches(repo *git.Repository) error {
 }
 
 func openRepository(path string) (*git.Repository, error) {
-	dot := osfs.New(path)
-	storage := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
-	return git.Open(storage, dot)
+	return git.Open(newSyncStorage(path), nil)
 }
 
 func initializeOrigin(repo *git.Repository, address string) error {
@@ -60,3 +82,182 @@ func initializeOrigin(repo *git.Repository, address string) error {
 
 	return nil
 }
+
+// normalizeURL returns the URL of the remote repository; local paths are made
+// absolute such that the cache directory does not depend on the working directory.
+func normalizeURL(url string) (string, bool, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return "", false, err
+	}
+	if ep.Protocol != "file" {
+		return url, false, nil
+	}
+	if strings.HasPrefix(url, "file://") {
+		return url, true, nil
+	}
+	abs, err := filepath.Abs(url)
+	if err != nil {
+		return "", false, err
+	}
+	return abs, true, nil
+}
+
+// cleanupTempObjects removes the temporary pack and object files an interrupted
+// fetch can leave behind in the cached repository.
+func (r *gitRepository) cleanupTempObjects() error {
+	if r.dir == "" {
+		return nil
+	}
+	packDir := filepath.Join(r.dir, "objects", "pack")
+	entries, err := os.ReadDir(packDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "tmp_") {
+			if err := os.Remove(filepath.Join(packDir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncStorage serializes the object lookups of the filesystem storage, which
+// builds its pack indexes lazily and is not safe for concurrent reads. The
+// storage is used as is otherwise.
+//
+// The cached repository is shared with other processes, which add packs when
+// they fetch and replace them when they collect garbage. The pack index of the
+// storage is built once, so the packs are indexed again when the repository
+// is locked and when an object is not found.
+type syncStorage struct {
+	*filesystem.Storage
+	mu sync.Mutex
+}
+
+func newSyncStorage(path string) *syncStorage {
+	return &syncStorage{
+		Storage: filesystem.NewStorage(osfs.New(path), cache.NewObjectLRUDefault()),
+	}
+}
+
+// Reindex drops the pack index, which is built again on the next lookup
+func (s *syncStorage) Reindex() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Storage.Reindex()
+}
+
+// reindexed reports whether a lookup that failed with the error can succeed
+// after the packs are indexed again; the pack index is dropped if so. An
+// object of another type than requested exists and is not looked up again.
+func (s *syncStorage) reindexed(err error, t plumbing.ObjectType, h plumbing.Hash) bool {
+	switch {
+	case errors.Is(err, dotgit.ErrPackfileNotFound):
+	case errors.Is(err, plumbing.ErrObjectNotFound):
+		if t != plumbing.AnyObject && s.Storage.HasEncodedObject(h) == nil {
+			return false
+		}
+	default:
+		return false
+	}
+	s.Storage.Reindex()
+	return true
+}
+
+func (s *syncStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.SetEncodedObject(obj)
+}
+
+// LazyWriter creates the object writer under the lock; the content is written
+// to a temporary file without holding it.
+func (s *syncStorage) LazyWriter() (io.WriteCloser, func(typ plumbing.ObjectType, sz int64) error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.LazyWriter()
+}
+
+func (s *syncStorage) HasEncodedObject(h plumbing.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.HasEncodedObject(h)
+}
+
+func (s *syncStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size, err := s.Storage.EncodedObjectSize(h)
+	if err != nil && s.reindexed(err, plumbing.AnyObject, h) {
+		return s.Storage.EncodedObjectSize(h)
+	}
+	return size, err
+}
+
+func (s *syncStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, err := s.Storage.EncodedObject(t, h)
+	if err != nil && s.reindexed(err, t, h) {
+		return s.Storage.EncodedObject(t, h)
+	}
+	return obj, err
+}
+
+func (s *syncStorage) DeltaObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, err := s.Storage.DeltaObject(t, h)
+	if err != nil && s.reindexed(err, t, h) {
+		return s.Storage.DeltaObject(t, h)
+	}
+	return obj, err
+}
+
+// syncMemoryStorage serializes the object lookups and writes of the in-memory
+// storage, whose maps are not safe for concurrent use. Trees are read without
+// the lock of the repository while commits store objects.
+type syncMemoryStorage struct {
+	*memory.Storage
+	mu sync.RWMutex
+}
+
+func newSyncMemoryStorage() *syncMemoryStorage {
+	return &syncMemoryStorage{Storage: memory.NewStorage()}
+}
+
+func (s *syncMemoryStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.SetEncodedObject(obj)
+}
+
+func (s *syncMemoryStorage) DeleteLooseObject(h plumbing.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.DeleteLooseObject(h)
+}
+
+func (s *syncMemoryStorage) HasEncodedObject(h plumbing.Hash) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.HasEncodedObject(h)
+}
+
+func (s *syncMemoryStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.EncodedObjectSize(h)
+}
+
+func (s *syncMemoryStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.EncodedObject(t, h)
+}
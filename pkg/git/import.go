@@ -0,0 +1,451 @@
+package git
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/henderiw/logger/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ImportSourceType string
+
+const (
+	ImportSourceArchive   ImportSourceType = "archive"
+	ImportSourceDirectory ImportSourceType = "directory"
+)
+
+// ImportSource describes the origin of imported files; it is recorded in the
+// commit annotation
+type ImportSource struct {
+	// Type is the type of the source: a tar.gz archive or a local directory
+	Type ImportSourceType `json:"type"`
+	// Location is the path of the archive or directory as provided
+	Location string `json:"location"`
+	// SHA256 is the hex encoded sha256 of the archive; empty for a directory
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ImportOptions holds the optional configuration of an import
+type ImportOptions struct {
+	// Path is the directory the files are imported to, relative to the directory
+	// of the repository; defaults to the directory of the repository. Its
+	// content is replaced by the imported files.
+	Path string
+	// StripComponents removes the number of leading path elements from the
+	// entries of an archive (e.g. 1 for a vendor-1.0/ top level directory)
+	StripComponents int
+	// Message is the commit message; defaults to "Import <location>"
+	Message string
+	// Tag creates an annotated tag of the imported commit, if set
+	Tag string
+	// Push pushes the branch and the tag after the import
+	Push bool
+	// DryRun computes the commit without updating the branch or tag; nothing
+	// is pushed
+	DryRun bool
+}
+
+// ImportResult describes the commit created by Import
+type ImportResult struct {
+	// Branch is the branch the files are imported on
+	Branch string
+	// Source is the origin of the files
+	Source ImportSource
+	// Parent is the commit the import is based on: the current commit of the
+	// branch or, when the branch does not exist, the main branch
+	Parent plumbing.Hash
+	// Commit is the imported commit; the parent when nothing changed
+	Commit plumbing.Hash
+	// Files is the number of imported files
+	Files int
+	// Changes holds the files added, modified or deleted by the import, relative
+	// to the directory of the repository and sorted by path
+	Changes []FileChange
+	// Tag is the tag created for the commit, if requested
+	Tag string
+	// UpdatedRefs holds the local references updated by the import
+	UpdatedRefs []string
+	// Push is the outcome of the push, if requested
+	Push *PushResult
+	// DryRun indicates the references were not updated
+	DryRun bool
+}
+
+// Import commits the files of a tar.gz archive or a local directory on the
+// branch, replacing the content of the import path. No commit is created when
+// the files are unchanged on an existing branch.
+func (r *gitRepository) Import(ctx context.Context, branch, src string, opts *ImportOptions) (*ImportResult, error) {
+	ctx, span := tracer.Start(ctx, "gitRepository::Import", trace.WithAttributes())
+	defer span.End()
+
+	log := log.FromContext(ctx)
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	if branch == "" {
+		return nil, fmt.Errorf("import requires a branch")
+	}
+	// the source is read before locking the repository; the files of a
+	// directory are only listed and streamed into the blobs when stored
+	files, source, cleanup, err := readImportSource(ctx, src, opts.StripComponents)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	localRef := RefName(branch).RefInLocal()
+	exists := true
+	parentCommit, err := r.getCommitFromBranch(ctx, localRef)
+	if err != nil {
+		if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return nil, err
+		}
+		// a new branch starts from the main branch
+		exists = false
+		parentCommit, err = r.getCommit(ctx, r.ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	importPath := strings.Trim(path.Join(r.directory, opts.Path), "/")
+	if importPath == "." {
+		importPath = ""
+	}
+	ch, err := newCommitHelper(ctx, r, parentCommit.Hash, importPath, plumbing.ZeroHash)
+	if err != nil {
+		return nil, err
+	}
+	if importPath == "" {
+		// the import replaces the whole tree
+		ch.trees[""].Entries = nil
+	}
+	for name, f := range files {
+		if err := ch.storeFileWithMode(path.Join(importPath, name), f.content, f.mode); err != nil {
+			return nil, fmt.Errorf("cannot store file %q: %w", name, err)
+		}
+	}
+
+	message := opts.Message
+	if message == "" {
+		message = fmt.Sprintf("Import %s", source.Location)
+	}
+	message = strings.TrimRight(message, "\n") + "\n"
+	tagMessage := message
+	message, err = AnnotateCommitMessage(message, &gitAnnotation{
+		PackagePath: importPath,
+		Task:        &Task{Type: "import"},
+		Source:      source,
+	})
+	if err != nil {
+		return nil, err
+	}
+	commitHash, _, err := ch.commit(ctx, message, importPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	commit, err := r.repo.CommitObject(commitHash)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := r.diffCommits(ctx, parentCommit, commit, &DiffOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 && exists {
+		// nothing changed; the commit is unreferenced and removed by GC
+		commitHash = parentCommit.Hash
+	}
+
+	result := &ImportResult{
+		Branch:      branch,
+		Source:      *source,
+		Parent:      parentCommit.Hash,
+		Commit:      commitHash,
+		Files:       len(files),
+		Changes:     changes,
+		Tag:         opts.Tag,
+		UpdatedRefs: []string{},
+		DryRun:      opts.DryRun,
+	}
+	refSpecs := newPushRefSpecBuilder()
+	refSpecs.AddRefToPush(localRef, commitHash)
+	// the tag is created first, such that an existing tag of another commit
+	// leaves the branch unchanged
+	if opts.Tag != "" {
+		tagHash, created, err := r.createTag(ctx, opts.Tag, commitHash, tagMessage, opts.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		if created && !opts.DryRun {
+			result.UpdatedRefs = append(result.UpdatedRefs, RefName(opts.Tag).TagInLocal().String())
+		}
+		refSpecs.AddRefToPush(RefName(opts.Tag).TagInLocal(), tagHash)
+	}
+	if !opts.DryRun && (commitHash != parentCommit.Hash || !exists) {
+		if err := r.repo.Storer.SetReference(plumbing.NewHashReference(localRef, commitHash)); err != nil {
+			return nil, err
+		}
+		result.UpdatedRefs = append(result.UpdatedRefs, localRef.String())
+	}
+	if opts.Push {
+		result.Push = &PushResult{
+			Ref:    localRef.String(),
+			Commit: commitHash,
+			DryRun: opts.DryRun,
+		}
+		if err := r.push(ctx, refSpecs, result.Push); err != nil {
+			return nil, err
+		}
+	}
+	log.Debug("import", "branch", branch, "source", source.Location, "commit", commitHash.String(), "files", len(files), "changes", len(changes), "dryRun", opts.DryRun)
+	return result, nil
+}
+
+// createTag creates an annotated tag of the commit, signed with the signer of
+// the repository. An existing tag of the commit is reused; a tag of another
+// commit is an error. It returns the hash of the tag object and whether the
+// tag was created.
+func (r *gitRepository) createTag(ctx context.Context, name string, commitHash plumbing.Hash, message string, dryRun bool) (plumbing.Hash, bool, error) {
+	tagRef := RefName(name).TagInLocal()
+	if existing, err := r.repo.Reference(tagRef, false); err == nil {
+		target := existing.Hash()
+		if tag, err := r.repo.TagObject(existing.Hash()); err == nil {
+			target = tag.Target
+		}
+		if target != commitHash {
+			return plumbing.ZeroHash, false, fmt.Errorf("tag %q points to %s: %w", name, target, git.ErrTagExists)
+		}
+		return existing.Hash(), false, nil
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return plumbing.ZeroHash, false, err
+	}
+
+	tag := &object.Tag{
+		Name: name,
+		Tagger: object.Signature{
+			Name:  r.committer.Name,
+			Email: r.committer.Email,
+			When:  time.Now(),
+		},
+		Message:    message,
+		TargetType: plumbing.CommitObject,
+		Target:     commitHash,
+	}
+	if err := r.signTag(tag); err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+	eo := r.repo.Storer.NewEncodedObject()
+	if err := tag.Encode(eo); err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+	tagHash, err := r.repo.Storer.SetEncodedObject(eo)
+	if err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+	if !dryRun {
+		if err := r.repo.Storer.SetReference(plumbing.NewHashReference(tagRef, tagHash)); err != nil {
+			return plumbing.ZeroHash, false, err
+		}
+	}
+	return tagHash, true, nil
+}
+
+// importFile is a file of an import source
+type importFile struct {
+	// content is the content of the file or the target of a symlink
+	content Content
+	mode    filemode.FileMode
+}
+
+// readImportSource reads the files of the archive or directory, keyed by their
+// slash separated path relative to the root of the source. Regular files,
+// executables and symlinks are imported. The returned function removes the
+// files the entries of an archive are spooled to; it must be called once the
+// files are committed.
+func readImportSource(ctx context.Context, src string, stripComponents int) (map[string]importFile, *ImportSource, func(), error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if fi.IsDir() {
+		files, err := readImportDirectory(ctx, src)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return files, &ImportSource{Type: ImportSourceDirectory, Location: src}, func() {}, nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+	spool, err := os.MkdirTemp("", "git-import-")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(spool) }
+	h := sha256.New()
+	files, err := readImportArchive(ctx, io.TeeReader(f, h), stripComponents, spool)
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, fmt.Errorf("cannot read archive %s: %w", src, err)
+	}
+	return files, &ImportSource{Type: ImportSourceArchive, Location: src, SHA256: hex.EncodeToString(h.Sum(nil))}, cleanup, nil
+}
+
+func readImportDirectory(ctx context.Context, dir string) (map[string]importFile, error) {
+	log := log.FromContext(ctx)
+	files := map[string]importFile{}
+	if err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = importFile{content: StringContent(filepath.ToSlash(target)), mode: filemode.Symlink}
+		case d.Type().IsRegular():
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			// the content is streamed from the file when committed
+			content, err := FileContent(p)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = importFile{content: content, mode: FileModeOf(fi.Mode())}
+		default:
+			log.Info("skipping file, not a regular file or symlink", "fileName", rel)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// readImportArchive reads the entries of the archive; the content of the regular
+// files is spooled to files in the spool directory, such that the archive is
+// never held in memory.
+func readImportArchive(ctx context.Context, rd io.Reader, stripComponents int, spool string) (map[string]importFile, error) {
+	log := log.FromContext(ctx)
+	gr, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	files := map[string]importFile{}
+	spooled := 0
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, err := importEntryName(hdr.Name, stripComponents)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			content, err := spoolFile(tr, filepath.Join(spool, strconv.Itoa(spooled)))
+			if err != nil {
+				return nil, fmt.Errorf("cannot read %q: %w", hdr.Name, err)
+			}
+			spooled++
+			files[name] = importFile{content: content, mode: FileModeOf(hdr.FileInfo().Mode())}
+		case tar.TypeSymlink:
+			files[name] = importFile{content: StringContent(hdr.Linkname), mode: filemode.Symlink}
+		case tar.TypeDir:
+		default:
+			log.Info("skipping archive entry, not a regular file or symlink", "fileName", hdr.Name)
+		}
+	}
+	// consume the remainder, such that the checksum covers the whole archive
+	if _, err := io.Copy(io.Discard, rd); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// spoolFile writes the content of the reader to the file and returns it as
+// content
+func spoolFile(rd io.Reader, name string) (Content, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, rd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return FileContent(name)
+}
+
+// importEntryName returns the cleaned name of the archive entry without the
+// leading path elements; empty when nothing remains. Names escaping the root
+// are rejected.
+func importEntryName(name string, stripComponents int) (string, error) {
+	cleaned := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid archive entry %q: outside of the archive root", name)
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	parts := strings.Split(cleaned, "/")
+	if len(parts) <= stripComponents {
+		return "", nil
+	}
+	return strings.Join(parts[stripComponents:], "/"), nil
+}
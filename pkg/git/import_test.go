@@ -0,0 +1,257 @@
+package git_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+// writeArchive writes a tar.gz archive of the files below a top level directory
+func writeArchive(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	entries := make(map[string]string, len(files))
+	for p, content := range files {
+		entries["vendor-1.0/"+p] = content
+	}
+	writeArchiveEntries(t, name, entries)
+}
+
+// writeArchiveEntries writes a tar.gz archive of regular files with the entry
+// names as is
+func writeArchiveEntries(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for p, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: p, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportArchive(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+
+	archive := filepath.Join(t.TempDir(), "vendor.tar.gz")
+	files := map[string]string{
+		"a.yang":     "module a;\n",
+		"sub/b.yang": "module b;\n",
+	}
+	writeArchive(t, archive, files)
+	// the entries are spooled to the temporary directory while imported
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	if _, err := repo.Import(ctx, "vendor", archive, &git.ImportOptions{StripComponents: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		if got := readFile(t, repo, "vendor", name); got != want {
+			t.Errorf("content of %s = %q, want %q", name, got, want)
+		}
+	}
+	des, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(des) != 0 {
+		t.Errorf("spooled entries were not removed: %v", des)
+	}
+}
+
+func TestImportDirectory(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"a.yang":      "module a;\n",
+		"sub/b.yang":  "module b;\n",
+		".git/config": "[core]\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/b.yang", filepath.Join(src, "b.yang")); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := repo.Import(ctx, "vendor", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Files != 4 {
+		t.Errorf("imported %d files, want 4", imported.Files)
+	}
+	want := map[string]string{
+		"a.yang":     filemode.Regular.String() + " module a;\n",
+		"b.yang":     filemode.Symlink.String() + " sub/b.yang",
+		"run.sh":     filemode.Executable.String() + " #!/bin/sh\n",
+		"sub/b.yang": filemode.Regular.String() + " module b;\n",
+	}
+	if got := listFileModes(t, repo, "vendor"); !reflect.DeepEqual(got, want) {
+		t.Errorf("files %v, want %v", got, want)
+	}
+
+	// importing the same files again leaves the branch unchanged
+	again, err := repo.Import(ctx, "vendor", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Commit != imported.Commit || again.Parent != imported.Commit || len(again.Changes) != 0 || len(again.UpdatedRefs) != 0 {
+		t.Errorf("unchanged import created commit %s from %s: changes %v, updated refs %v", again.Commit, again.Parent, again.Changes, again.UpdatedRefs)
+	}
+}
+
+func TestImportRejectsEntriesOutsideOfTheRoot(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+
+	for name, tc := range map[string]struct {
+		entry           string
+		stripComponents int
+	}{
+		"parent":          {entry: "../evil.yang"},
+		"nested parent":   {entry: "vendor-1.0/../../evil.yang", stripComponents: 1},
+		"absolute":        {entry: "/etc/evil.yang"},
+		"stripped parent": {entry: "vendor-1.0/sub/../../../evil.yang", stripComponents: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "evil.tar.gz")
+			writeArchiveEntries(t, archive, map[string]string{tc.entry: "evil\n"})
+			_, err := repo.Import(context.Background(), "evil", archive, &git.ImportOptions{StripComponents: tc.stripComponents})
+			if err == nil || !strings.Contains(err.Error(), "outside of the archive root") {
+				t.Fatalf("expected the entry to be rejected, got %v", err)
+			}
+			if _, err := repo.Resolve(context.Background(), "evil"); err == nil {
+				t.Errorf("branch evil was created")
+			}
+		})
+	}
+}
+
+func TestImportTagAndPush(t *testing.T) {
+	_, remote, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+
+	archive := filepath.Join(t.TempDir(), "vendor.tar.gz")
+	writeArchive(t, archive, map[string]string{"a.yang": "module a;\n"})
+	opts := &git.ImportOptions{StripComponents: 1, Tag: "v1", Push: true}
+
+	// a dry run updates and pushes nothing
+	dryRunOpts := *opts
+	dryRunOpts.DryRun = true
+	dryRun, err := repo.Import(ctx, "vendor", archive, &dryRunOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dryRun.UpdatedRefs) != 0 || dryRun.Push == nil || !dryRun.Push.DryRun {
+		t.Errorf("unexpected dry run result: updated refs %v, push %+v", dryRun.UpdatedRefs, dryRun.Push)
+	}
+	for _, ref := range []string{"vendor", "v1"} {
+		if _, err := repo.Resolve(ctx, ref); err == nil {
+			t.Errorf("dry run created %s", ref)
+		}
+	}
+	for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName("vendor"), plumbing.NewTagReferenceName("v1")} {
+		if _, err := remote.Reference(name, false); err == nil {
+			t.Errorf("dry run pushed %s", name)
+		}
+	}
+
+	imported, err := repo.Import(ctx, "vendor", archive, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Commit != dryRun.Commit {
+		t.Errorf("imported commit %s, the dry run computed %s", imported.Commit, dryRun.Commit)
+	}
+	wantRefs := []string{git.RefName("v1").TagInLocal().String(), git.RefName("vendor").RefInLocal().String()}
+	if !reflect.DeepEqual(imported.UpdatedRefs, wantRefs) {
+		t.Errorf("updated refs %v, want %v", imported.UpdatedRefs, wantRefs)
+	}
+	branch, err := remote.Reference(plumbing.NewBranchReferenceName("vendor"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch.Hash() != imported.Commit {
+		t.Errorf("remote branch is %s, want %s", branch.Hash(), imported.Commit)
+	}
+	tagRef, err := remote.Reference(plumbing.NewTagReferenceName("v1"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := remote.TagObject(tagRef.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Target != imported.Commit {
+		t.Errorf("remote tag points to %s, want %s", tag.Target, imported.Commit)
+	}
+
+	// the tag cannot be moved to another commit
+	writeArchive(t, archive, map[string]string{"a.yang": "module a2;\n"})
+	if _, err := repo.Import(ctx, "vendor", archive, opts); !errors.Is(err, gogit.ErrTagExists) {
+		t.Errorf("expected %v, got %v", gogit.ErrTagExists, err)
+	}
+	if info, err := repo.Resolve(ctx, "vendor"); err != nil || info.Commit != imported.Commit {
+		t.Errorf("branch vendor moved to %v (%v), want %s", info, err, imported.Commit)
+	}
+}
+
+// listFileModes returns the mode and content of the files of the ref by name
+func listFileModes(t *testing.T, repo git.GitRepository, ref string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	if _, err := repo.List(context.Background(), ref, func(ctx context.Context, tree *object.Tree) error {
+		return tree.Files().ForEach(func(f *object.File) error {
+			content, err := f.Contents()
+			if err != nil {
+				return err
+			}
+			files[f.Name] = f.Mode.String() + " " + content
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/henderiw/git-loader/pkg/git/lfs"
+)
+
+// LFSOptions configures how the Git LFS pointers of the repository are resolved
+type LFSOptions struct {
+	// Endpoint is the url of the LFS server; defaults to <url>.git/info/lfs for
+	// http(s) repositories. Pointers are returned as is when there is no endpoint.
+	Endpoint string
+	// HTTPClient is used for the requests to the LFS server; defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Disabled returns the pointers as is
+	Disabled bool
+}
+
+// newLFSClient returns the client resolving the LFS pointers of the repository
+// or nil when LFS is not configured. The objects are cached with the cached
+// repository, keyed by oid; in-memory repositories cache them in memory.
+func (r *gitRepository) newLFSClient(opts *LFSOptions) (*lfs.Client, error) {
+	if opts == nil {
+		opts = &LFSOptions{}
+	}
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = lfs.Endpoint(r.url)
+	}
+	if opts.Disabled || endpoint == "" {
+		return nil, nil
+	}
+	cacheDir := ""
+	if r.dir != "" {
+		cacheDir = filepath.Join(r.dir, "lfs", "objects")
+	}
+	return lfs.NewClient(&lfs.Options{
+		Endpoint:   endpoint,
+		CacheDir:   cacheDir,
+		HTTPClient: opts.HTTPClient,
+		Auth:       r.authorizeLFS,
+	})
+}
+
+// authorizeLFS adds the credentials of the repository to a request to the LFS server
+func (r *gitRepository) authorizeLFS(ctx context.Context, req *http.Request) error {
+	auth, err := r.getAuthMethod(ctx, false)
+	if err != nil {
+		return fmt.Errorf("failed to obtain git credentials: %w", err)
+	}
+	if auth, ok := auth.(githttp.AuthMethod); ok {
+		auth.SetAuth(req)
+	}
+	return nil
+}
+
+// OpenFile returns a reader of the content of the file and its size. The
+// content of a Git LFS pointer is fetched from the LFS server of the
+// repository, unless it is cached. It can be called from a ListFunc.
+func (r *gitRepository) OpenFile(ctx context.Context, f *object.File) (io.ReadCloser, int64, error) {
+	p, err := r.lfsPointer(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	if p == nil {
+		rd, err := f.Reader()
+		if err != nil {
+			return nil, 0, err
+		}
+		return rd, f.Size, nil
+	}
+	rd, err := r.lfs.Open(ctx, p)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot resolve lfs pointer %q: %w", f.Name, err)
+	}
+	return rd, p.Size, nil
+}
+
+// lfsPointer returns the LFS pointer of the file or nil when the file is not
+// a pointer or LFS is not configured
+func (r *gitRepository) lfsPointer(f *object.File) (*lfs.Pointer, error) {
+	if r.lfs == nil || f.Mode == filemode.Symlink || f.Size > lfs.MaxPointerSize {
+		return nil, nil
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := lfs.ParsePointer([]byte(content))
+	if !ok {
+		return nil, nil
+	}
+	return p, nil
+}
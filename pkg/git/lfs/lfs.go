@@ -0,0 +1,349 @@
+// Package lfs resolves Git LFS pointer files to the content of their objects
+// using the batch API of an LFS server.
+package lfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// MaxPointerSize is the maximum size of a pointer file; larger blobs are
+	// never pointers
+	MaxPointerSize = 1024
+
+	specVersion = "https://git-lfs.github.com/spec/v1"
+	mediaType   = "application/vnd.git-lfs+json"
+)
+
+var (
+	// ErrObjectNotFound is returned when the LFS server does not have the object
+	ErrObjectNotFound = errors.New("lfs object not found")
+	// ErrChecksum is returned when the downloaded content does not match the pointer
+	ErrChecksum = errors.New("lfs object does not match the pointer")
+	// ErrUnauthorized is returned when the LFS server rejects the credentials
+	ErrUnauthorized = errors.New("lfs server rejected the credentials")
+
+	oidRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// Pointer references the content of a file stored in Git LFS
+type Pointer struct {
+	// Oid is the hex encoded sha256 of the content
+	Oid string
+	// Size is the size of the content in bytes
+	Size int64
+}
+
+// ParsePointer parses the content of a blob as a pointer file; it returns false
+// when the content is not a pointer.
+func ParsePointer(content []byte) (*Pointer, bool) {
+	if len(content) > MaxPointerSize || !bytes.HasPrefix(content, []byte("version "+specVersion+"\n")) {
+		return nil, false
+	}
+	p := &Pointer{Size: -1}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			return nil, false
+		}
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || !oidRegexp.MatchString(oid) {
+				return nil, false
+			}
+			p.Oid = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil, false
+			}
+			p.Size = size
+		}
+	}
+	if p.Oid == "" || p.Size < 0 {
+		return nil, false
+	}
+	return p, true
+}
+
+// String returns the pointer file of the pointer
+func (r *Pointer) String() string {
+	return fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", specVersion, r.Oid, r.Size)
+}
+
+// NewPointer returns the pointer of the content
+func NewPointer(content []byte) *Pointer {
+	sum := sha256.Sum256(content)
+	return &Pointer{Oid: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+}
+
+// AuthFunc adds the credentials to a request to the LFS server
+type AuthFunc func(ctx context.Context, req *http.Request) error
+
+// Options holds the configuration of a client
+type Options struct {
+	// Endpoint is the url of the LFS server, e.g. https://host/org/repo.git/info/lfs
+	Endpoint string
+	// CacheDir is the directory of the objects, keyed by oid; objects are cached
+	// in memory when not set
+	CacheDir string
+	// HTTPClient is used for the requests; defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Auth adds the credentials to the requests, if set
+	Auth AuthFunc
+}
+
+// Client downloads the objects of pointers from an LFS server
+type Client struct {
+	endpoint   string
+	cacheDir   string
+	httpClient *http.Client
+	auth       AuthFunc
+
+	// objects caches the objects by oid when there is no cache directory
+	m       sync.Mutex
+	objects map[string][]byte
+}
+
+// NewClient returns a client of the LFS server
+func NewClient(opts *Options) (*Client, error) {
+	if opts == nil || opts.Endpoint == "" {
+		return nil, fmt.Errorf("lfs endpoint is required")
+	}
+	c := &Client{
+		endpoint:   strings.TrimRight(opts.Endpoint, "/"),
+		cacheDir:   opts.CacheDir,
+		httpClient: opts.HTTPClient,
+		auth:       opts.Auth,
+		objects:    map[string][]byte{},
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	return c, nil
+}
+
+// Endpoint returns the default LFS endpoint of the url of a repository, or an
+// empty string when the url is not an http(s) url.
+func Endpoint(url string) string {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return ""
+	}
+	url = strings.TrimRight(url, "/")
+	if !strings.HasSuffix(url, ".git") {
+		url += ".git"
+	}
+	return url + "/info/lfs"
+}
+
+// Open returns a reader of the content of the pointer. The content is served
+// from the cache when present and otherwise downloaded and verified.
+func (r *Client) Open(ctx context.Context, p *Pointer) (io.ReadCloser, error) {
+	if !oidRegexp.MatchString(p.Oid) {
+		return nil, fmt.Errorf("invalid lfs oid %q", p.Oid)
+	}
+	if r.cacheDir == "" {
+		r.m.Lock()
+		b, ok := r.objects[p.Oid]
+		r.m.Unlock()
+		if !ok {
+			var buf bytes.Buffer
+			if err := r.download(ctx, p, &buf); err != nil {
+				return nil, err
+			}
+			b = buf.Bytes()
+			r.m.Lock()
+			r.objects[p.Oid] = b
+			r.m.Unlock()
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	path := r.cachePath(p.Oid)
+	if f, err := os.Open(path); err == nil {
+		if fi, err := f.Stat(); err == nil && fi.Size() == p.Size {
+			return f, nil
+		}
+		// a cached object of another size is corrupt -> download it again
+		f.Close()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp_"+p.Oid+"_")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := r.download(ctx, p, tmp); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	// the object is verified -> concurrent downloads of the same object
+	// replace it with the same content
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// cachePath returns the path of the object in the cache, laid out like the
+// objects of git lfs: <oid[0:2]>/<oid[2:4]>/<oid>
+func (r *Client) cachePath(oid string) string {
+	return filepath.Join(r.cacheDir, oid[0:2], oid[2:4], oid)
+}
+
+type batchRequest struct {
+	Operation string        `json:"operation"`
+	Transfers []string      `json:"transfers"`
+	Objects   []batchObject `json:"objects"`
+}
+
+type batchObject struct {
+	Oid     string                 `json:"oid"`
+	Size    int64                  `json:"size"`
+	Actions map[string]batchAction `json:"actions,omitempty"`
+	Error   *batchError            `json:"error,omitempty"`
+}
+
+type batchAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+type batchError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type batchResponse struct {
+	Objects []batchObject `json:"objects"`
+}
+
+// download writes the verified content of the pointer to the writer
+func (r *Client) download(ctx context.Context, p *Pointer, w io.Writer) error {
+	action, err := r.batch(ctx, p)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, action.Href, nil)
+	if err != nil {
+		return err
+	}
+	if len(action.Header) != 0 {
+		// the server provides the credentials of the download
+		for k, v := range action.Header {
+			req.Header.Set(k, v)
+		}
+	} else if err := r.authorize(ctx, req); err != nil {
+		return err
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot download lfs object %s: %w", p.Oid, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return r.statusError(resp, p)
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), io.LimitReader(resp.Body, p.Size+1))
+	if err != nil {
+		return fmt.Errorf("cannot download lfs object %s: %w", p.Oid, err)
+	}
+	if n != p.Size || hex.EncodeToString(h.Sum(nil)) != p.Oid {
+		return fmt.Errorf("%w: %s", ErrChecksum, p.Oid)
+	}
+	return nil
+}
+
+// batch requests the download action of the object
+func (r *Client) batch(ctx context.Context, p *Pointer) (*batchAction, error) {
+	b, err := json.Marshal(&batchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   []batchObject{{Oid: p.Oid, Size: p.Size}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint+"/objects/batch", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaType)
+	req.Header.Set("Content-Type", mediaType)
+	if err := r.authorize(ctx, req); err != nil {
+		return nil, err
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lfs batch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, r.statusError(resp, p)
+	}
+	br := &batchResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(br); err != nil {
+		return nil, fmt.Errorf("invalid lfs batch response: %w", err)
+	}
+	for _, o := range br.Objects {
+		if o.Oid != p.Oid {
+			continue
+		}
+		if o.Error != nil {
+			if o.Error.Code == http.StatusNotFound {
+				return nil, fmt.Errorf("%w: %s: %s", ErrObjectNotFound, p.Oid, o.Error.Message)
+			}
+			return nil, fmt.Errorf("lfs object %s: %s (%d)", p.Oid, o.Error.Message, o.Error.Code)
+		}
+		action, ok := o.Actions["download"]
+		if !ok {
+			return nil, fmt.Errorf("lfs batch response has no download action for %s", p.Oid)
+		}
+		return &action, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, p.Oid)
+}
+
+func (r *Client) authorize(ctx context.Context, req *http.Request) error {
+	if r.auth == nil {
+		return nil
+	}
+	return r.auth(ctx, req)
+}
+
+// statusError returns the error of a response with an unexpected status
+func (r *Client) statusError(resp *http.Response, p *Pointer) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("lfs server responded %s for %s: %s", resp.Status, p.Oid, strings.TrimSpace(string(msg)))
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrObjectNotFound, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package git_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+	"github.com/henderiw/git-loader/pkg/git/schema"
+)
+
+func TestLFSPointerIsResolved(t *testing.T) {
+	srv, remote, url := newTestRemote(t, nil)
+	content := bytes.Repeat([]byte("module big;\n"), 1024)
+	pointer := srv.AddLFSObject("org/repo", content)
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{
+		"yang/big.yang":   pointer,
+		"yang/small.yang": "module small;\n",
+	}, "add lfs object"); err != nil {
+		t.Fatal(err)
+	}
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+
+	// the content of the pointer is served when the file is opened
+	if _, err := repo.List(ctx, "main", func(ctx context.Context, tree *object.Tree) error {
+		f, err := tree.File("yang/big.yang")
+		if err != nil {
+			return err
+		}
+		rd, size, err := repo.OpenFile(ctx, f)
+		if err != nil {
+			return err
+		}
+		defer rd.Close()
+		got, err := io.ReadAll(rd)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, content) || size != int64(len(content)) {
+			t.Errorf("content of the pointer has %d bytes (size %d), want %d", len(got), size, len(content))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Requests(gittest.LFSDownloadService) != 1 {
+		t.Errorf("lfs downloads = %d, want 1", srv.Requests(gittest.LFSDownloadService))
+	}
+
+	// the schema files are copied with the content of the pointer
+	s := &schema.Schema{RootPath: t.TempDir(), CR: &invv1alpha1.Schema{Spec: invv1alpha1.SchemaSpec{Provider: "p", Version: "v1"}}}
+	copyFiles := func() *schema.CopyResult {
+		t.Helper()
+		var result *schema.CopyResult
+		if _, err := repo.List(ctx, "main", func(ctx context.Context, tree *object.Tree) error {
+			tree, err := tree.Tree("yang")
+			if err != nil {
+				return err
+			}
+			result, err = s.CopyFiles(ctx, tree, &schema.CopyOptions{Files: repo})
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	result := copyFiles()
+	if len(result.Added) != 2 || len(result.Failed) != 0 {
+		t.Fatalf("unexpected copy result: %+v", result)
+	}
+	got, err := os.ReadFile(filepath.Join(s.RootPath, "p", "v1", "big.yang"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("copied %d bytes, want the %d bytes of the lfs object", len(got), len(content))
+	}
+	sum := sha256.Sum256(content)
+	for _, c := range result.Checksums {
+		if c.Path != "big.yang" {
+			continue
+		}
+		if !c.LFS || c.SHA256 != hex.EncodeToString(sum[:]) || c.Size != int64(len(content)) {
+			t.Errorf("unexpected checksum of the lfs object: %+v", c)
+		}
+	}
+
+	if result := copyFiles(); result.Unchanged != 2 {
+		t.Errorf("unexpected copy result of unchanged files: %+v", result)
+	}
+	// the content is streamed through temporary files that are not left behind
+	des, err := os.ReadDir(filepath.Join(s.RootPath, "p", "v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(des) != 2 {
+		t.Errorf("unexpected files in the schema directory: %v", des)
+	}
+}
@@ -0,0 +1,74 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+func TestLocalRemote(t *testing.T) {
+	for name, url := range map[string]func(dir string) string{
+		"file url": func(dir string) string { return "file://" + dir },
+		"path":     func(dir string) string { return dir },
+		"relative path": func(dir string) string {
+			wd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel, err := filepath.Rel(wd, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return rel
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			remote, err := gogit.PlainInit(dir, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := remote.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("main"))); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := gittest.CommitFiles(remote, "main", map[string]string{"a/b.yaml": "b: 1\n"}, "initial"); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			repo, err := git.OpenRepository(ctx, t.TempDir(), &configv1alpha1.GitRepository{URL: url(dir)}, &git.Options{
+				RetryPolicy: &git.RetryPolicy{MaxAttempts: 1},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close(ctx)
+			if got := readFile(t, repo, "main", "a/b.yaml"); got != "b: 1\n" {
+				t.Errorf("content of a/b.yaml = %q, want %q", got, "b: 1\n")
+			}
+
+			ref := workspaceRef("pkg", "ws")
+			committed, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.Push(ctx, ref, nil); err != nil {
+				t.Fatal(err)
+			}
+			remoteRef, err := remote.Reference(plumbing.NewBranchReferenceName("pkg/ws"), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if remoteRef.Hash() != committed.Commit {
+				t.Errorf("remote branch is %s, want %s", remoteRef.Hash(), committed.Commit)
+			}
+		})
+	}
+}
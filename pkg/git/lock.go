@@ -0,0 +1,263 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/henderiw/logger/log"
+)
+
+const (
+	// DefaultLockTimeout is the default time to wait for the lock of a cached repository
+	DefaultLockTimeout = time.Minute
+
+	// lockSuffix is added to the directory of the cached repository to form the
+	// lock file; the lock file lives next to the directory such that it survives
+	// quarantine and eviction
+	lockSuffix       = ".lock"
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// ErrLockTimeout is returned when the lock of a cached repository cannot be
+// acquired in time
+var ErrLockTimeout = errors.New("timeout acquiring repository lock")
+
+// lockInfo identifies the holder of a lock
+type lockInfo struct {
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"`
+	Acquired time.Time `json:"acquired"`
+}
+
+// fileLock is an advisory lock shared by the processes using the same cache
+// directory. The lock is taken on the open lock file with flock, which the
+// operating system releases when the holder exits; a lock of a process that
+// died is therefore never held and needs no takeover. The lock file is never
+// removed, as other processes can be waiting on it. The holder of an
+// exclusive lock records itself in the file, which is only used to report who
+// holds the lock.
+type fileLock struct {
+	f         *os.File
+	exclusive bool
+}
+
+// lockFile acquires the lock, waiting up to timeout
+func lockFile(ctx context.Context, path string, timeout time.Duration, exclusive bool) (*fileLock, error) {
+	log := log.FromContext(ctx)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for {
+		l, err := tryLockFile(path, exclusive)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			return l, nil
+		}
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				if holder := readLock(path); holder != nil {
+					return nil, fmt.Errorf("%w %s, held by pid %d on %s since %s", ErrLockTimeout, path, holder.PID, holder.Host, holder.Acquired.Format(time.RFC3339))
+				}
+				return nil, fmt.Errorf("%w %s", ErrLockTimeout, path)
+			}
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+			log.Debug("waiting for repository lock", "path", path)
+		}
+	}
+}
+
+// tryLockFile acquires the lock without waiting; nil is returned when the lock
+// is held by another lock that conflicts with it. Shared locks only conflict
+// with exclusive locks.
+func tryLockFile(path string, exclusive bool) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open lock %s: %w", path, err)
+	}
+	locked, err := flock(f, exclusive)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot acquire lock %s: %w", path, err)
+	}
+	if !locked {
+		f.Close()
+		return nil, nil
+	}
+	l := &fileLock{f: f, exclusive: exclusive}
+	if exclusive {
+		host, _ := os.Hostname()
+		b, err := json.Marshal(lockInfo{
+			PID:      os.Getpid(),
+			Host:     host,
+			Acquired: time.Now(),
+		})
+		if err == nil {
+			// the holder is informational -> a failure to record it is ignored
+			if err := f.Truncate(0); err == nil {
+				_, _ = f.WriteAt(b, 0)
+			}
+		}
+	}
+	return l, nil
+}
+
+// readLock returns the recorded holder of the lock, if any
+func readLock(path string) *lockInfo {
+	b, err := os.ReadFile(path)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	holder := &lockInfo{}
+	if err := json.Unmarshal(b, holder); err != nil || holder.PID == 0 {
+		return nil
+	}
+	return holder
+}
+
+// Unlock releases the lock
+func (l *fileLock) Unlock() error {
+	if l.exclusive {
+		_ = l.f.Truncate(0)
+	}
+	// closing the file releases the lock
+	return l.f.Close()
+}
+
+// upgrade takes the shared lock exclusively without waiting; false is returned,
+// with the lock shared again, when the lock is shared with others. The lock is
+// released in between, so the caller must keep others from taking it
+// exclusively meanwhile.
+func (l *fileLock) upgrade() (bool, error) {
+	if err := funlock(l.f); err != nil {
+		return false, fmt.Errorf("cannot release lock %s: %w", l.f.Name(), err)
+	}
+	locked, err := flock(l.f, true)
+	if err == nil && !locked {
+		locked, err = flock(l.f, false)
+		if err == nil && !locked {
+			err = errors.New("lock is taken exclusively")
+		}
+		if err != nil {
+			return false, fmt.Errorf("cannot acquire lock %s again: %w", l.f.Name(), err)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot acquire lock %s: %w", l.f.Name(), err)
+	}
+	l.exclusive = true
+	return true, nil
+}
+
+// downgrade shares the exclusive lock again
+func (l *fileLock) downgrade() error {
+	if err := funlock(l.f); err != nil {
+		return fmt.Errorf("cannot release lock %s: %w", l.f.Name(), err)
+	}
+	l.exclusive = false
+	locked, err := flock(l.f, false)
+	if err == nil && !locked {
+		err = errors.New("lock is taken exclusively")
+	}
+	if err != nil {
+		return fmt.Errorf("cannot acquire lock %s again: %w", l.f.Name(), err)
+	}
+	return nil
+}
+
+// lock acquires the lock of the cached repository that serializes fetches, ref
+// updates and pushes across processes; the returned function releases the lock.
+// In-memory repositories are not shared and need no lock. Other processes can
+// have changed the packs while the lock was not held, so the packs are indexed
+// again before the repository is read.
+func (r *gitRepository) lock(ctx context.Context) (func(), error) {
+	if r.dir == "" {
+		return func() {}, nil
+	}
+	unlock, err := lockRepository(ctx, r.dir, r.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := r.repo.Storer.(*syncStorage); ok {
+		s.Reindex()
+	}
+	return unlock, nil
+}
+
+func lockRepository(ctx context.Context, dir string, timeout time.Duration) (func(), error) {
+	l, err := lockFile(ctx, dir+lockSuffix, timeout, true)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := l.Unlock(); err != nil {
+			log.FromContext(ctx).Error("cannot release repository lock", "dir", dir, "error", err)
+		}
+	}, nil
+}
+
+// walkGuard keeps the objects of the trees that are walked without the lock of
+// the repository (List and Archive): commits and fetches only add objects and
+// run alongside the walks, while GC and Repair, which remove objects, wait for
+// the walks to end. A new walk only waits for a removal in progress, not for a
+// pending one, such that a walk can start another walk. The zero value is ready
+// to use.
+type walkGuard struct {
+	mu       sync.Mutex
+	cond     sync.Cond
+	walks    int
+	removing bool
+}
+
+// startWalk waits for a removal in progress and registers a walk; the returned
+// function ends the walk.
+func (g *walkGuard) startWalk() func() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.removing {
+		g.wait()
+	}
+	g.walks++
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.walks--
+		g.cond.Broadcast()
+	}
+}
+
+// startRemoval waits for the walks to end and blocks new walks; the returned
+// function ends the removal. It must be called before the lock of the
+// repository is taken, as a walk can wait for that lock.
+func (g *walkGuard) startRemoval() func() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.walks > 0 || g.removing {
+		g.wait()
+	}
+	g.removing = true
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.removing = false
+		g.cond.Broadcast()
+	}
+}
+
+func (g *walkGuard) wait() {
+	if g.cond.L == nil {
+		g.cond.L = &g.mu
+	}
+	g.cond.Wait()
+}
@@ -0,0 +1,53 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "repo"+lockSuffix)
+
+	l, err := lockFile(ctx, path, time.Second, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, err := tryLockFile(path, true); err != nil || other != nil {
+		t.Fatalf("lock acquired twice (err %v)", err)
+	}
+	_, err = lockFile(ctx, path, 3*lockPollInterval, true)
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("error = %v, want %v", err, ErrLockTimeout)
+	}
+	if holder := readLock(path); holder == nil || holder.PID != os.Getpid() {
+		t.Errorf("holder = %+v, want pid %d", holder, os.Getpid())
+	}
+
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = tryLockFile(path, true)
+	if err != nil || l == nil {
+		t.Fatalf("released lock cannot be acquired (err %v)", err)
+	}
+	l.Unlock()
+}
+
+func TestLockFileOfDeadHolder(t *testing.T) {
+	// a holder that died leaves the lock file with its info behind; the lock
+	// itself is released by the operating system
+	path := filepath.Join(t.TempDir(), "repo"+lockSuffix)
+	if err := os.WriteFile(path, []byte(`{"pid":1,"host":"other","acquired":"2020-01-01T00:00:00Z"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := lockFile(context.Background(), path, time.Second, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Unlock()
+}
@@ -0,0 +1,283 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/henderiw/logger/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ConflictKind string
+
+const (
+	// ConflictKindBothModified indicates the file was changed differently in main and in the workspace
+	ConflictKindBothModified ConflictKind = "bothModified"
+	// ConflictKindBothAdded indicates the file was added with different content in main and in the workspace
+	ConflictKindBothAdded ConflictKind = "bothAdded"
+	// ConflictKindDeletedByUs indicates the file was deleted in the workspace and changed in main
+	ConflictKindDeletedByUs ConflictKind = "deletedByUs"
+	// ConflictKindDeletedByThem indicates the file was deleted in main and changed in the workspace
+	ConflictKindDeletedByThem ConflictKind = "deletedByThem"
+)
+
+// MergeResult is the result of merging main into a workspace branch
+type MergeResult struct {
+	// Commit is the resulting commit of the workspace branch; when the merge has
+	// conflicts or the workspace is already up to date this is the current commit
+	// of the workspace branch.
+	Commit plumbing.Hash
+	// MergeBase is the common ancestor of main and the workspace branch
+	MergeBase plumbing.Hash
+	// UpToDate indicates main has no changes that are not part of the workspace branch
+	UpToDate bool
+	// Conflicts holds the files that could not be merged, sorted by path.
+	// No commit is created when conflicts are found.
+	Conflicts []MergeConflict
+}
+
+// MergeConflict describes a single file that could not be merged. The path is
+// relative to the package.
+type MergeConflict struct {
+	Path       string
+	Kind       ConflictKind
+	BaseHash   plumbing.Hash
+	OursHash   plumbing.Hash
+	TheirsHash plumbing.Hash
+}
+
+// Merge performs a three-way merge of the package tree between the merge base,
+// main and the workspace branch identified by ref. A clean merge is committed
+// on the workspace branch with main as additional parent; the files outside of
+// the package are taken from main.
+func (r *gitRepository) Merge(ctx context.Context, ref, packageName string) (*MergeResult, error) {
+	ctx, span := tracer.Start(ctx, "gitRepository::Merge", trace.WithAttributes())
+	defer span.End()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	log := log.FromContext(ctx)
+
+	oursCommit, err := r.getCommitFromBranch(ctx, plumbing.ReferenceName(ref))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find workspace ref %q: %w", ref, err)
+	}
+	theirsCommit, err := r.getCommit(ctx, r.ref)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := oursCommit.MergeBase(theirsCommit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find merge base between %s and %s: %w", oursCommit.Hash, theirsCommit.Hash, err)
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("no merge base between %s and %s", oursCommit.Hash, theirsCommit.Hash)
+	}
+	baseCommit := bases[0]
+
+	result := &MergeResult{
+		Commit:    oursCommit.Hash,
+		MergeBase: baseCommit.Hash,
+	}
+	if baseCommit.Hash == theirsCommit.Hash {
+		log.Info("workspace is up to date", "ref", ref, "main", theirsCommit.Hash.String())
+		result.UpToDate = true
+		return result, nil
+	}
+
+	packagePath := path.Join(r.directory, packageName)
+	baseTree, err := getPackageTree(baseCommit, packagePath)
+	if err != nil {
+		return nil, err
+	}
+	oursTree, err := getPackageTree(oursCommit, packagePath)
+	if err != nil {
+		return nil, err
+	}
+	theirsTree, err := getPackageTree(theirsCommit, packagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	oursChanges, err := treeChanges(ctx, baseTree, oursTree)
+	if err != nil {
+		return nil, err
+	}
+	theirsChanges, err := treeChanges(ctx, baseTree, theirsTree)
+	if err != nil {
+		return nil, err
+	}
+	files, err := treeFiles(oursTree)
+	if err != nil {
+		return nil, err
+	}
+
+	for p, theirs := range theirsChanges {
+		ours, changed := oursChanges[p]
+		if !changed {
+			// only changed in main -> take the change from main
+			if theirs == nil {
+				delete(files, p)
+			} else {
+				files[p] = *theirs
+			}
+			continue
+		}
+		if equalTreeEntry(ours, theirs) {
+			// same change on both sides
+			continue
+		}
+		result.Conflicts = append(result.Conflicts, newMergeConflict(p, baseTree, ours, theirs))
+	}
+	if len(result.Conflicts) != 0 {
+		sort.Slice(result.Conflicts, func(i, j int) bool {
+			return result.Conflicts[i].Path < result.Conflicts[j].Path
+		})
+		return result, nil
+	}
+
+	// the tree of main has the changes of main outside of the package; only the
+	// package is replaced with the merged files. The workspace branch stays the
+	// first parent.
+	ch, err := newCommitHelper(ctx, r, theirsCommit.Hash, packagePath, plumbing.ZeroHash)
+	if err != nil {
+		return nil, err
+	}
+	ch.parentCommitHash = oursCommit.Hash
+	for p, e := range files {
+		if err := ch.storeBlobHashInTrees(path.Join(packagePath, p), e.Hash, e.Mode); err != nil {
+			return nil, err
+		}
+	}
+
+	annotation := &gitAnnotation{
+		PackagePath: packagePath,
+	}
+	message := fmt.Sprintf("Merge %s into %s\n", r.ref, ref)
+	message, err = AnnotateCommitMessage(message, annotation)
+	if err != nil {
+		return nil, err
+	}
+	commitHash, _, err := ch.commit(ctx, message, packagePath, theirsCommit.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+	if err := r.repo.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(ref), commitHash)); err != nil {
+		return nil, err
+	}
+	result.Commit = commitHash
+	return result, nil
+}
+
+// getPackageTree returns the tree at packagePath in the commit or nil if the
+// package does not exist in the commit.
+func getPackageTree(commit *object.Commit, packagePath string) (*object.Tree, error) {
+	rootTree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve commit %v to tree (corrupted repository?): %w", commit.Hash, err)
+	}
+	if packagePath == "" {
+		return rootTree, nil
+	}
+	tree, err := rootTree.Tree(packagePath)
+	if err != nil {
+		if err == object.ErrDirectoryNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return tree, nil
+}
+
+// treeChanges returns the files changed between 2 trees; the entry is nil for
+// deleted files.
+func treeChanges(ctx context.Context, from, to *object.Tree) (map[string]*object.TreeEntry, error) {
+	changes, err := object.DiffTreeWithOptions(ctx, from, to, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*object.TreeEntry, len(changes))
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		switch action {
+		case merkletrie.Delete:
+			result[change.From.Name] = nil
+		default:
+			entry := change.To.TreeEntry
+			result[change.To.Name] = &entry
+		}
+	}
+	return result, nil
+}
+
+// treeFiles returns all files in the tree by path
+func treeFiles(tree *object.Tree) (map[string]object.TreeEntry, error) {
+	files := map[string]object.TreeEntry{}
+	if tree == nil {
+		return files, nil
+	}
+	w := object.NewTreeWalker(tree, true, nil)
+	defer w.Close()
+	for {
+		name, entry, err := w.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		files[name] = entry
+	}
+	return files, nil
+}
+
+func equalTreeEntry(a, b *object.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+func newMergeConflict(p string, baseTree *object.Tree, ours, theirs *object.TreeEntry) MergeConflict {
+	conflict := MergeConflict{Path: p}
+	if baseTree != nil {
+		if base, err := baseTree.FindEntry(p); err == nil {
+			conflict.BaseHash = base.Hash
+		}
+	}
+	if ours != nil {
+		conflict.OursHash = ours.Hash
+	}
+	if theirs != nil {
+		conflict.TheirsHash = theirs.Hash
+	}
+	switch {
+	case ours == nil:
+		conflict.Kind = ConflictKindDeletedByUs
+	case theirs == nil:
+		conflict.Kind = ConflictKindDeletedByThem
+	case conflict.BaseHash.IsZero():
+		conflict.Kind = ConflictKindBothAdded
+	default:
+		conflict.Kind = ConflictKindBothModified
+	}
+	return conflict
+}
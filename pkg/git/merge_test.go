@@ -0,0 +1,135 @@
+package git_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+func TestMergeKeepsChangesOfMainOutsideThePackage(t *testing.T) {
+	_, remote, url := newTestRemote(t, map[string]string{
+		"README.md":  "readme\n",
+		"pkg/a.yaml": "a: 1\n",
+	})
+	ctx := context.Background()
+	root := t.TempDir()
+	repoCfg := &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}
+	opts := &git.Options{CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword)}
+	ref := workspaceRef("pkg", "ws")
+
+	repo, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"a.yaml": "a: 2\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close(ctx)
+
+	// main changes a file outside of the package and adds a file to the package
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{
+		"README.md":  "updated\n",
+		"pkg/a.yaml": "a: 1\n",
+		"pkg/b.yaml": "b: 1\n",
+	}, "update main"); err != nil {
+		t.Fatal(err)
+	}
+	repo, err = git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+
+	merged, err := repo.Merge(ctx, ref, "pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Conflicts) != 0 || merged.UpToDate {
+		t.Fatalf("unexpected merge result: %+v", merged)
+	}
+	for name, want := range map[string]string{
+		"README.md":  "updated\n",
+		"pkg/a.yaml": "a: 2\n",
+		"pkg/b.yaml": "b: 1\n",
+	} {
+		if got := readFile(t, repo, "pkg/ws", name); got != want {
+			t.Errorf("content of %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+	_, remote, url := newTestRemote(t, map[string]string{
+		"pkg/a.yaml": "a: 1\n",
+		"pkg/b.yaml": "b: 1\n",
+		"pkg/c.yaml": "c: 1\n",
+	})
+	ctx := context.Background()
+	root := t.TempDir()
+	repoCfg := &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}
+	opts := &git.Options{CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword)}
+	ref := workspaceRef("pkg", "ws")
+
+	repo, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{
+		"a.yaml": "a: 2\n",
+		"b.yaml": "b: 1\n",
+		"c.yaml": "c: 2\n",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Close(ctx)
+
+	// main changes the same file differently and deletes a file the workspace changed
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{
+		"pkg/a.yaml": "a: 3\n",
+		"pkg/b.yaml": "b: 1\n",
+	}, "update main"); err != nil {
+		t.Fatal(err)
+	}
+	repo, err = git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+	main, err := repo.Resolve(ctx, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := repo.Merge(ctx, ref, "pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conflicts []string
+	for _, c := range merged.Conflicts {
+		conflicts = append(conflicts, c.Path+" "+string(c.Kind))
+	}
+	want := []string{"a.yaml " + string(git.ConflictKindBothModified), "c.yaml " + string(git.ConflictKindDeletedByThem)}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts %v, want %v", conflicts, want)
+	}
+	if merged.Commit != committed.Commit {
+		t.Errorf("merge result commit is %s, want the workspace commit %s", merged.Commit, committed.Commit)
+	}
+
+	// no ref is updated
+	for name, want := range map[string]plumbing.Hash{"pkg/ws": committed.Commit, "main": main.Commit} {
+		info, err := repo.Resolve(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Commit != want {
+			t.Errorf("%s moved from %s to %s", name, want, info.Commit)
+		}
+	}
+}
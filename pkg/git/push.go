@@ -2,6 +2,7 @@ package git
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -20,7 +21,6 @@ func newPushRefSpecBuilder() *pushRefSpecBuilder {
 }
 
 func (b *pushRefSpecBuilder) AddRefToPush(to plumbing.ReferenceName, hash plumbing.Hash) {
-	fmt.Println("AddRefToPush to", to, hash)
 	b.pushRefs[to] = hash
 }
 
@@ -42,12 +42,14 @@ func (b *pushRefSpecBuilder) BuildRefSpecs() (push []config.RefSpec, require []c
 			return nil, nil, err
 		}
 
-		fmt.Println("BuildRefSpecs pushRefs", local, remote)
-
-		if !hash.IsZero() {
-			push = append(push, config.RefSpec(fmt.Sprintf("%s:%s", hash, remote)))
-		} else {
+		switch {
+		case hash.IsZero():
 			push = append(push, config.RefSpec(fmt.Sprintf(":%s", remote)))
+		case strings.HasPrefix(local.String(), tagsPrefixInLocalRepo):
+			// go-git only pushes hashes of commits; tags are pushed by name
+			push = append(push, config.RefSpec(fmt.Sprintf("%s:%s", local, remote)))
+		default:
+			push = append(push, config.RefSpec(fmt.Sprintf("%s:%s", hash, remote)))
 		}
 	}
 
@@ -57,8 +59,6 @@ func (b *pushRefSpecBuilder) BuildRefSpecs() (push []config.RefSpec, require []c
 			return nil, nil, err
 		}
 
-		fmt.Println("BuildRefSpecs require", local, remote)
-
 		if !hash.IsZero() {
 			require = append(require, config.RefSpec(fmt.Sprintf("%s:%s", hash, remote)))
 		}
@@ -13,6 +13,9 @@ const (
 
 	MainBranch RefName = "main"
 
+	// quarantineSuffix is added to the directory of a corrupted cached repository
+	quarantineSuffix = ".quarantine-"
+
 	branchPrefixInLocalRepo  = "refs/remotes/" + OriginName + "/"
 	branchPrefixInRemoteRepo = "refs/heads/"
 	tagsPrefixInLocalRepo    = "refs/tags/"
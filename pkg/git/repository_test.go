@@ -0,0 +1,342 @@
+package git_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+const (
+	testUsername = "user"
+	testPassword = "secret"
+)
+
+// newTestRemote starts a server with a repository holding an initial commit on main
+func newTestRemote(t *testing.T, files map[string]string) (*gittest.Server, *gogit.Repository, string) {
+	t.Helper()
+	srv := gittest.NewServer(&gittest.ServerOptions{Username: testUsername, Password: testPassword})
+	t.Cleanup(srv.Close)
+	remote, url, err := srv.CreateRepository("org/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files == nil {
+		files = map[string]string{"README.md": "readme\n"}
+	}
+	if _, err := gittest.CommitFiles(remote, "main", files, "initial"); err != nil {
+		t.Fatal(err)
+	}
+	return srv, remote, url
+}
+
+// openTestRepository opens the repository in a cache root of the test with the
+// credentials of the resolver
+func openTestRepository(t *testing.T, url string, resolver *gittest.CredentialResolver) git.GitRepository {
+	t.Helper()
+	ctx := context.Background()
+	repo, err := git.OpenRepository(ctx, t.TempDir(), &configv1alpha1.GitRepository{
+		URL:         url,
+		Credentials: "credentials",
+	}, &git.Options{
+		CredentialResolver: resolver,
+		RetryPolicy:        &git.RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close(ctx) })
+	return repo
+}
+
+// readFile returns the content of the file in the ref
+func readFile(t *testing.T, repo git.GitRepository, ref, name string) string {
+	t.Helper()
+	var content string
+	if _, err := repo.List(context.Background(), ref, func(ctx context.Context, tree *object.Tree) error {
+		f, err := tree.File(name)
+		if err != nil {
+			return err
+		}
+		content, err = f.Contents()
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func workspaceRef(packageName, workspace string) string {
+	return string(git.RefName(packageName + "/" + workspace).RefInLocal())
+}
+
+func TestOpenRepositoryFetches(t *testing.T) {
+	_, _, url := newTestRemote(t, map[string]string{"a/b.yaml": "b: 1\n"})
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+
+	if got := readFile(t, repo, "main", "a/b.yaml"); got != "b: 1\n" {
+		t.Errorf("content of a/b.yaml = %q, want %q", got, "b: 1\n")
+	}
+}
+
+func TestListReturnsTheListedCommit(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+	ref := workspaceRef("pkg", "ws")
+
+	first, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := repo.List(ctx, "pkg/ws", func(ctx context.Context, tree *object.Tree) error {
+		// the ref moves while the tree is listed
+		_, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 2\n"}, nil)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Commit != first.Commit {
+		t.Errorf("listed commit %s, want %s", info.Commit, first.Commit)
+	}
+}
+
+func TestOpenRepositoryFetchesNewCommits(t *testing.T) {
+	srv, remote, url := newTestRemote(t, nil)
+	root := t.TempDir()
+	ctx := context.Background()
+	opts := &git.Options{CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword)}
+	repoCfg := &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}
+
+	repo, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Close(ctx)
+
+	hash, err := gittest.CommitFiles(remote, "main", map[string]string{"README.md": "updated\n"}, "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches := srv.Requests("git-upload-pack")
+	// the cached repository is reused and fetched again
+	repo, err = git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+	if srv.Requests("git-upload-pack") == fetches {
+		t.Errorf("cached repository was not fetched")
+	}
+	info, err := repo.Resolve(ctx, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Commit != hash {
+		t.Errorf("main resolves to %s, want %s", info.Commit, hash)
+	}
+}
+
+func TestCommitAndPush(t *testing.T) {
+	_, remote, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+	ref := workspaceRef("pkg", "ws")
+
+	committed, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, repo, "pkg/ws", "pkg/c.yaml"); got != "c: 1\n" {
+		t.Errorf("content of pkg/c.yaml = %q, want %q", got, "c: 1\n")
+	}
+
+	pushed, err := repo.Push(ctx, ref, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed.Commit != committed.Commit || pushed.UpToDate {
+		t.Errorf("pushed %s (up to date %t), want %s", pushed.Commit, pushed.UpToDate, committed.Commit)
+	}
+	remoteRef, err := remote.Reference(plumbing.NewBranchReferenceName("pkg/ws"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remoteRef.Hash() != committed.Commit {
+		t.Errorf("remote branch is %s, want %s", remoteRef.Hash(), committed.Commit)
+	}
+
+	pushed, err = repo.Push(ctx, ref, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pushed.UpToDate {
+		t.Errorf("second push is not up to date")
+	}
+}
+
+func TestPushConflict(t *testing.T) {
+	_, remote, url := newTestRemote(t, nil)
+	repo := openTestRepository(t, url, gittest.NewCredentialResolver(testUsername, testPassword))
+	ctx := context.Background()
+	ref := workspaceRef("pkg", "ws")
+
+	if _, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the branch is updated in the remote concurrently
+	if _, err := gittest.CommitFiles(remote, "pkg/ws", map[string]string{"pkg/c.yaml": "c: 2\n"}, "concurrent"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := repo.Push(ctx, ref, nil)
+	if err == nil {
+		t.Fatal("push of a non fast-forward update succeeded")
+	}
+	if class := git.GetErrorClass(err); class != git.ErrorClassConflict {
+		t.Errorf("error class = %s, want %s: %v", class, git.ErrorClassConflict, err)
+	}
+}
+
+func TestCredentialRefresh(t *testing.T) {
+	srv, _, url := newTestRemote(t, nil)
+	resolver := gittest.NewCredentialResolver(testUsername, testPassword)
+	repo := openTestRepository(t, url, resolver)
+	ctx := context.Background()
+	ref := workspaceRef("pkg", "ws")
+	resolved := resolver.Resolved()
+
+	// the credentials are rotated: the cached credentials are rejected and
+	// the new credentials are resolved
+	srv.SetCredentials(testUsername, "rotated")
+	resolver.SetCredentials(testUsername, "rotated")
+
+	if _, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Push(ctx, ref, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolver.Resolved(); got != resolved+1 {
+		t.Errorf("credentials resolved %d times, want %d", got, resolved+1)
+	}
+	if got := srv.Requests("git-receive-pack"); got == 0 {
+		t.Errorf("nothing was pushed")
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	_, err := git.OpenRepository(context.Background(), t.TempDir(), &configv1alpha1.GitRepository{
+		URL:         url,
+		Credentials: "credentials",
+	}, &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, "wrong"),
+	})
+	if err == nil {
+		t.Fatal("open with wrong credentials succeeded")
+	}
+	if !errors.Is(err, git.ErrAuth) {
+		t.Errorf("error is not an auth error: %v", err)
+	}
+}
+
+func TestFetchWithUnpushedCommits(t *testing.T) {
+	_, remote, url := newTestRemote(t, nil)
+	ctx := context.Background()
+	root := t.TempDir()
+	repoCfg := &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}
+	opts := &git.Options{CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword)}
+
+	repo, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit(ctx, workspaceRef("pkg", "ws"), "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close(ctx)
+
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{"README.md": "updated\n"}, "update"); err != nil {
+		t.Fatal(err)
+	}
+	// the commit of the workspace is unknown to the remote
+	repo, err = git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+	if got := readFile(t, repo, "main", "README.md"); got != "updated\n" {
+		t.Errorf("content of README.md = %q, want %q", got, "updated\n")
+	}
+}
+
+func TestOpenRepositoryIsNotEvicted(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	ctx := context.Background()
+	root := t.TempDir()
+	repo, err := git.OpenRepository(ctx, root, &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}, &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cache of another process does not know the repository is open
+	cache := git.NewCache(root, &git.CacheOptions{Quota: 1})
+	res, err := cache.Evict(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Evicted) != 0 {
+		t.Errorf("open repository was evicted: %v", res.Evicted)
+	}
+
+	repo.Close(ctx)
+	res, err = cache.Evict(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Evicted) != 1 {
+		t.Errorf("closed repository was not evicted: %v", res.Evicted)
+	}
+}
+
+func TestRepositoriesShareTheCache(t *testing.T) {
+	_, remote, url := newTestRemote(t, nil)
+	ctx := context.Background()
+	root := t.TempDir()
+	repoCfg := &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}
+	opts := &git.Options{CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword)}
+
+	a, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close(ctx)
+	readFile(t, a, "main", "README.md")
+
+	// another repository on the same root fetches new objects into the cache
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{"README.md": "updated\n"}, "update"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close(ctx)
+
+	if got := readFile(t, a, "main", "README.md"); got != "updated\n" {
+		t.Errorf("content of README.md = %q, want %q", got, "updated\n")
+	}
+	if _, err := a.Commit(ctx, workspaceRef("pkg", "ws"), "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy defines how remote operations are retried on transient
+// and rate limited errors.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of an operation, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff limits the delay between retries
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay increases with after every retry
+	Multiplier float64
+	// Jitter randomizes the delay with the given fraction (0-1) to avoid
+	// synchronized retries
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used when no retry policy is provided
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// backoff returns the delay before the retry following the attempt (starting at 1).
+// Rate limited operations back off twice as long.
+func (r *RetryPolicy) backoff(attempt int, class ErrorClass) time.Duration {
+	d := float64(r.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= r.Multiplier
+	}
+	if class == ErrorClassRateLimited {
+		d *= 2
+	}
+	if max := float64(r.MaxBackoff); r.MaxBackoff > 0 && d > max {
+		d = max
+	}
+	if r.Jitter > 0 {
+		d += d * r.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// wait blocks for the delay or until the context is done
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package git_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+func TestRetry(t *testing.T) {
+	tests := map[string]struct {
+		statusCode int
+		failures   int
+		// retries is the number of requests that are retried
+		retries int
+		class   git.ErrorClass
+	}{
+		"no failures": {},
+		"unavailable": {
+			statusCode: http.StatusServiceUnavailable,
+			failures:   2,
+			retries:    2,
+		},
+		"rate limited": {
+			statusCode: http.StatusTooManyRequests,
+			failures:   1,
+			retries:    1,
+		},
+		"attempts exhausted": {
+			statusCode: http.StatusBadGateway,
+			failures:   3,
+			retries:    2,
+			class:      git.ErrorClassTransient,
+		},
+		"not found": {
+			statusCode: http.StatusNotFound,
+			failures:   1,
+			class:      git.ErrorClassNotFound,
+		},
+	}
+	// the requests of a successful fetch
+	srv, _, url := newTestRemote(t, nil)
+	openRetryTestRepository(t, url)
+	fetchRequests := srv.Requests(transport.UploadPackServiceName)
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, _, url := newTestRemote(t, nil)
+			srv.InjectFailures(tc.statusCode, tc.failures)
+			err := openRetryTestRepository(t, url)
+			switch {
+			case tc.class == "" && err != nil:
+				t.Fatal(err)
+			case tc.class != "" && git.GetErrorClass(err) != tc.class:
+				t.Fatalf("expected error class %s, got %s: %v", tc.class, git.GetErrorClass(err), err)
+			}
+			want := tc.retries + 1
+			if err == nil {
+				want = tc.retries + fetchRequests
+			}
+			if got := srv.Requests(transport.UploadPackServiceName); got != want {
+				t.Errorf("expected %d requests, got %d", want, got)
+			}
+		})
+	}
+}
+
+// openRetryTestRepository opens the repository with a retry policy of 3
+// attempts without delay between them
+func openRetryTestRepository(t *testing.T, url string) error {
+	t.Helper()
+	ctx := context.Background()
+	repo, err := git.OpenRepository(ctx, t.TempDir(), &configv1alpha1.GitRepository{
+		URL:         url,
+		Credentials: "credentials",
+	}, &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+		RetryPolicy:        &git.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 1},
+	})
+	if err != nil {
+		return err
+	}
+	repo.Close(ctx)
+	return nil
+}
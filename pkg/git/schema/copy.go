@@ -2,11 +2,18 @@ package schema
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
 	"github.com/henderiw/logger/log"
@@ -18,9 +25,76 @@ type Schema struct {
 }
 
 func (r *Schema) Copy(ctx context.Context, tree *object.Tree) error {
+	_, err := r.CopyFiles(ctx, tree, nil)
+	return err
+}
+
+// CopyOptions holds the optional configuration of copying the schema files
+type CopyOptions struct {
+	// DryRun computes the files that would be added or changed without writing them
+	DryRun bool
+	// Files opens the files of the tree, e.g. the repository to resolve Git LFS
+	// pointers; the blobs are read as is when not set
+	Files FileOpener
+}
+
+// FileOpener returns a reader of the content of a file of a tree and its size
+type FileOpener interface {
+	OpenFile(ctx context.Context, f *object.File) (io.ReadCloser, int64, error)
+}
+
+// CopyResult describes the files copied to <root>/<provider>/<version>; the
+// paths are relative to that directory and sorted.
+type CopyResult struct {
+	// Added holds the files that did not exist
+	Added []string
+	// Changed holds the files whose content changed
+	Changed []string
+	// Unchanged is the number of files that already had the content
+	Unchanged int
+	// Failed holds the files that could not be read or written; an earlier copy
+	// of the file is removed
+	Failed []string
+	// Deleted holds the files that are not in the tree and were removed
+	Deleted []string
+	// Checksums holds the checksums of the files that were copied or up to date,
+	// sorted by path
+	Checksums []FileChecksum
+	// DryRun indicates no files were written
+	DryRun bool
+}
+
+// Files returns the number of files in the tree that were copied or up to date
+func (r *CopyResult) Files() int {
+	return len(r.Added) + len(r.Changed) + r.Unchanged
+}
+
+// CopyFiles copies the files of the tree to <root>/<provider>/<version>. Files
+// that cannot be read or written are reported and skipped. Executables keep the
+// exec bit; symlinks are recreated when their target stays within the
+// directory and otherwise reported as failed. Other files in the directory,
+// except the manifest, are removed such that it holds the copied files only.
+func (r *Schema) CopyFiles(ctx context.Context, tree *object.Tree, opts *CopyOptions) (*CopyResult, error) {
 	log := log.FromContext(ctx)
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
 	providerVersionBasePath := filepath.Join(r.RootPath, r.CR.Spec.Provider, r.CR.Spec.Version)
 
+	result := &CopyResult{
+		Added:     []string{},
+		Changed:   []string{},
+		Failed:    []string{},
+		Deleted:   []string{},
+		Checksums: []FileChecksum{},
+		DryRun:    opts.DryRun,
+	}
+	outcomes := map[string]*[]string{}
+	checksums := map[string]FileChecksum{}
+	var symlinks []string
+	// copied holds the files and symlinks that are (or would be) written, in
+	// the order of the tree
+	var copied []stagedFile
 	fit := tree.Files()
 	defer fit.Close()
 	for {
@@ -28,24 +102,472 @@ func (r *Schema) Copy(ctx context.Context, tree *object.Tree) error {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return fmt.Errorf("failed to load package resources: %w", err)
+			return result, fmt.Errorf("failed to load package resources: %w", err)
+		}
+		if file.Name == ManifestFileName {
+			log.Info("skipping file, reserved for the manifest", "fileName", file.Name)
+			continue
 		}
 		filePath := filepath.Join(providerVersionBasePath, file.Name)
-		fmt.Println("copy file", "from", file.Name, "to", filePath)
-		content, err := file.Contents()
+		var checksum FileChecksum
+		var unchanged, exists bool
+		if file.Mode == filemode.Symlink {
+			target, err := file.Contents()
+			if err != nil {
+				log.Info("cannot read file", "fileName", file.Name, "error", err.Error())
+				outcomes[file.Name] = &result.Failed
+				continue // we continue although we cannot read file
+			}
+			if err := validateSymlink(file.Name, target); err != nil {
+				log.Info("cannot copy symlink", "fileName", file.Name, "error", err.Error())
+				outcomes[file.Name] = &result.Failed
+				continue
+			}
+			symlinks = append(symlinks, file.Name)
+			copied = append(copied, stagedFile{name: file.Name, target: target})
+			checksum = newFileChecksum(file.Name, file.Mode, []byte(target))
+			unchanged, exists, err = isUnchangedSymlink(filePath, target)
+			if err != nil {
+				log.Info("cannot read file", "fileName", filePath, "error", err.Error())
+				outcomes[file.Name] = &result.Failed
+				continue
+			}
+			if !unchanged && !opts.DryRun {
+				if err := writeSymlink(providerVersionBasePath, filePath, target); err != nil {
+					log.Info("cannot write file", "fileName", filePath, "error", err.Error())
+					outcomes[file.Name] = &result.Failed
+					continue
+				}
+			}
+		} else {
+			// the content is streamed, as the content of a Git LFS pointer can be large
+			checksum, unchanged, exists, err = copyFile(ctx, opts.Files, file, providerVersionBasePath, filePath, opts.DryRun)
+			if err != nil {
+				log.Info("cannot copy file", "fileName", file.Name, "error", err.Error())
+				outcomes[file.Name] = &result.Failed
+				continue
+			}
+			copied = append(copied, stagedFile{name: file.Name})
+		}
+		if checksum.BlobHash != file.Hash.String() {
+			// the content of a Git LFS pointer is not the blob
+			checksum.BlobHash = file.Hash.String()
+			checksum.LFS = true
+		}
+		checksums[file.Name] = checksum
+
+		switch {
+		case unchanged:
+			outcomes[file.Name] = nil
+		case exists:
+			outcomes[file.Name] = &result.Changed
+		default:
+			outcomes[file.Name] = &result.Added
+		}
+	}
+	// a symlink can escape through other symlinks, which the check of its
+	// target does not cover. A dry run checks the files and symlinks in a staged
+	// copy of the directory as it would be written.
+	checkPath := providerVersionBasePath
+	if opts.DryRun {
+		staged, failed, err := stageFiles(providerVersionBasePath, copied)
+		if err != nil {
+			return result, fmt.Errorf("cannot stage files: %w", err)
+		}
+		defer os.RemoveAll(staged)
+		for _, name := range failed {
+			log.Info("cannot write file", "fileName", name)
+			outcomes[name] = &result.Failed
+		}
+		checkPath = staged
+	}
+	for _, name := range symlinks {
+		if outcomes[name] == &result.Failed {
+			continue
+		}
+		linkPath := filepath.Join(checkPath, name)
+		if ok, err := symlinkResolvesWithin(checkPath, linkPath); err != nil || !ok {
+			log.Info("removing symlink, resolves outside of the directory", "fileName", name)
+			if !opts.DryRun {
+				if err := os.Remove(linkPath); err != nil {
+					log.Info("cannot remove symlink", "fileName", linkPath, "error", err.Error())
+				}
+			}
+			outcomes[name] = &result.Failed
+		}
+	}
+
+	for name, outcome := range outcomes {
+		switch outcome {
+		case nil:
+			result.Unchanged++
+		default:
+			*outcome = append(*outcome, name)
+		}
+		if outcome != &result.Failed {
+			result.Checksums = append(result.Checksums, checksums[name])
+		}
+	}
+	kept := make(map[string]bool, len(result.Checksums))
+	for _, c := range result.Checksums {
+		kept[c.Path] = true
+	}
+	removed, err := removeFiles(providerVersionBasePath, kept, opts.DryRun)
+	if err != nil {
+		return result, fmt.Errorf("cannot remove files: %w", err)
+	}
+	for _, name := range removed {
+		if _, ok := outcomes[name]; !ok {
+			result.Deleted = append(result.Deleted, name)
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Changed)
+	sort.Strings(result.Failed)
+	sort.Slice(result.Checksums, func(i, j int) bool {
+		return result.Checksums[i].Path < result.Checksums[j].Path
+	})
+	return result, nil
+}
+
+// removeFiles removes the files in the directory that are not kept, except the
+// manifest, together with the directories that become empty, and returns them
+// relative to the directory. Symlinks are removed, not followed. Nothing is
+// removed in a dry run.
+func removeFiles(basePath string, kept map[string]bool, dryRun bool) ([]string, error) {
+	removed := []string{}
+	err := filepath.WalkDir(basePath, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
-			log.Info("cannot read file", "fileName", file.Name, "error", err.Error())
-			continue // we continue although we cannot read file
+			if p == basePath && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
 		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(basePath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ManifestFileName || kept[rel] {
+			return nil
+		}
+		removed = append(removed, rel)
+		if dryRun {
+			return nil
+		}
+		return os.Remove(p)
+	})
+	if err != nil || dryRun {
+		return removed, err
+	}
+	for _, rel := range removed {
+		// the directory is removed when empty, which fails otherwise
+		for dir := filepath.Dir(filepath.Join(basePath, rel)); dir != basePath; dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+		}
+	}
+	return removed, nil
+}
 
-		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-			log.Info("cannot write file", "fileName", filePath, "error", err.Error())
+// stagedFile is a file or, when the target is set, a symlink written to the
+// directory
+type stagedFile struct {
+	name   string
+	target string
+}
+
+// stageFiles recreates the directory in a temporary directory as it is after
+// the files are written, with empty regular files, such that the symlinks can
+// be checked without writing the directory. It returns the temporary directory
+// and the files that cannot be written.
+func stageFiles(basePath string, files []stagedFile) (string, []string, error) {
+	staged, err := os.MkdirTemp("", "schema-")
+	if err != nil {
+		return "", nil, err
+	}
+	// the existing directories, files and symlinks
+	if err := filepath.WalkDir(basePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == basePath && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
 		}
+		rel, err := filepath.Rel(basePath, p)
+		if err != nil {
+			return err
+		}
+		stagedPath := filepath.Join(staged, rel)
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, stagedPath)
+		case d.IsDir():
+			return os.MkdirAll(stagedPath, 0755)
+		default:
+			return os.WriteFile(stagedPath, nil, 0644)
+		}
+	}); err != nil {
+		os.RemoveAll(staged)
+		return "", nil, err
+	}
+	// the files replace them, like they are copied
+	var failed []string
+	for _, f := range files {
+		filePath := filepath.Join(staged, f.name)
+		if f.target != "" {
+			if err := writeSymlink(staged, filePath, f.target); err != nil {
+				failed = append(failed, f.name)
+			}
+			continue
+		}
+		if err := prepareDir(staged, filePath); err != nil {
+			failed = append(failed, f.name)
+			continue
+		}
+		if fi, err := os.Lstat(filePath); err == nil && !fi.IsDir() {
+			os.Remove(filePath)
+		}
+		if err := os.WriteFile(filePath, nil, 0644); err != nil {
+			failed = append(failed, f.name)
+		}
+	}
+	return staged, failed, nil
+}
+
+// openFile returns a reader of the content of the file and its size
+func openFile(ctx context.Context, files FileOpener, file *object.File) (io.ReadCloser, int64, error) {
+	if files == nil {
+		rd, err := file.Reader()
+		return rd, file.Size, err
+	}
+	return files.OpenFile(ctx, file)
+}
+
+// copyFile streams the content of the regular file to filePath and returns its
+// checksum. The content is written to a temporary file next to the destination,
+// which replaces the destination when its content or mode differs; nothing is
+// written in a dry run.
+func copyFile(ctx context.Context, files FileOpener, file *object.File, basePath, filePath string, dryRun bool) (checksum FileChecksum, unchanged, exists bool, err error) {
+	rd, size, err := openFile(ctx, files, file)
+	if err != nil {
+		return checksum, false, false, fmt.Errorf("cannot read file: %w", err)
+	}
+	defer rd.Close()
+	existing, exists, err := existingChecksum(filePath, file.Mode)
+	if err != nil {
+		return checksum, false, false, err
+	}
 
-		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
-			log.Info("cannot write file", "fileName", filePath, "error", err.Error())
+	cw := newChecksumWriter(file.Name, file.Mode, size)
+	if dryRun {
+		if _, err := io.Copy(cw, rd); err != nil {
+			return checksum, false, false, fmt.Errorf("cannot read file: %w", err)
 		}
+		checksum = cw.Checksum()
+		return checksum, exists && existing == checksum.SHA256, exists, nil
+	}
+
+	if err := prepareDir(basePath, filePath); err != nil {
+		return checksum, false, false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-"+filepath.Base(filePath)+"-")
+	if err != nil {
+		return checksum, false, false, err
+	}
+	// the temporary file is gone once it replaced the destination
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(io.MultiWriter(tmp, cw), rd); err != nil {
+		tmp.Close()
+		return checksum, false, false, fmt.Errorf("cannot copy file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return checksum, false, false, err
+	}
+	checksum = cw.Checksum()
+	if exists && existing == checksum.SHA256 {
+		return checksum, true, true, nil
+	}
+	if err := os.Chmod(tmp.Name(), filePerm(file.Mode)); err != nil {
+		return checksum, false, false, err
+	}
+	// a symlink at the destination is replaced, not followed
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return checksum, false, false, err
+	}
+	return checksum, false, exists, nil
+}
 
+// filePerm returns the permissions of a file with the git file mode
+func filePerm(mode filemode.FileMode) fs.FileMode {
+	if mode == filemode.Executable {
+		return 0755
+	}
+	return 0644
+}
+
+// validateSymlink checks the target of the symlink is relative and stays within
+// the directory of the schema
+func validateSymlink(name, target string) error {
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) {
+		return fmt.Errorf("invalid symlink target %q: must be relative", target)
+	}
+	resolved := path.Join(path.Dir(name), target)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("invalid symlink target %q: outside of the directory", target)
 	}
 	return nil
 }
+
+// isUnchangedSymlink returns whether the symlink exists with the target
+func isUnchangedSymlink(filePath string, target string) (unchanged, exists bool, err error) {
+	fi, err := os.Lstat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		return false, true, nil
+	}
+	existing, err := os.Readlink(filePath)
+	if err != nil {
+		return false, true, err
+	}
+	return existing == filepath.FromSlash(target), true, nil
+}
+
+// existingChecksum returns the sha256 of the existing regular file with the
+// permissions of the mode; the checksum is empty when the file does not exist
+// as such and has to be replaced.
+func existingChecksum(filePath string, mode filemode.FileMode) (string, bool, error) {
+	fi, err := os.Lstat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	if !fi.Mode().IsRegular() || fi.Mode().Perm()&0111 != filePerm(mode)&0111 {
+		return "", true, nil
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", true, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", true, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), true, nil
+}
+
+// prepareDir creates the directory of the file. The directory is not created
+// when it resolves outside of the base path, such that existing symlinks are
+// never followed outside of it.
+func prepareDir(basePath, filePath string) error {
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return err
+	}
+	// check the deepest existing directory before creating the missing ones
+	dir := filepath.Dir(filePath)
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil || existing == basePath {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	ok, err := resolvesWithin(basePath, existing)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("directory %s resolves outside of %s", existing, basePath)
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+// writeSymlink writes the symlink, replacing an existing file
+func writeSymlink(basePath, filePath, target string) error {
+	if err := prepareDir(basePath, filePath); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(filePath); err == nil {
+		if err := os.Remove(filePath); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(filepath.FromSlash(target), filePath)
+}
+
+// resolvesWithin returns whether the path resolves, following symlinks, to the
+// base path or a path within it
+func resolvesWithin(basePath, p string) (bool, error) {
+	base, err := filepath.EvalSymlinks(basePath)
+	if err != nil {
+		return false, err
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil {
+		return false, err
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// symlinkResolvesWithin returns whether the target of the symlink resolves
+// within the base path. The target is resolved element by element, following
+// symlinks, such that a target that does not exist is also checked.
+func symlinkResolvesWithin(basePath, linkPath string) (bool, error) {
+	base, err := filepath.EvalSymlinks(basePath)
+	if err != nil {
+		return false, err
+	}
+	target, err := os.Readlink(linkPath)
+	if err != nil {
+		return false, err
+	}
+	cur, err := filepath.EvalSymlinks(filepath.Dir(linkPath))
+	if err != nil {
+		return false, err
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(target), "/") {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+			continue
+		}
+		next := filepath.Join(cur, elem)
+		resolved, err := filepath.EvalSymlinks(next)
+		switch {
+		case err == nil:
+			cur = resolved
+		case os.IsNotExist(err):
+			cur = next
+		default:
+			return false, err
+		}
+	}
+	rel, err := filepath.Rel(base, cur)
+	if err != nil {
+		return false, err
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
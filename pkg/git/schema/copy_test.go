@@ -0,0 +1,331 @@
+package schema
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+)
+
+// testFile is a file of a test tree; the content of a symlink is its target
+type testFile struct {
+	content string
+	mode    filemode.FileMode
+}
+
+// newTestTree stores the files in memory and returns their root tree; files
+// are regular unless another mode is given
+func newTestTree(t *testing.T, files map[string]testFile) *object.Tree {
+	t.Helper()
+	s := memory.NewStorage()
+	hash, err := storeTestTree(s, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := object.GetTree(s, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func storeTestTree(s *memory.Storage, files map[string]testFile) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	dirs := map[string]map[string]testFile{}
+	for p, f := range files {
+		dir, rest, found := strings.Cut(p, "/")
+		if found {
+			if dirs[dir] == nil {
+				dirs[dir] = map[string]testFile{}
+			}
+			dirs[dir][rest] = f
+			continue
+		}
+		blob := s.NewEncodedObject()
+		blob.SetType(plumbing.BlobObject)
+		w, err := blob.Writer()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		w.Close()
+		hash, err := s.SetEncodedObject(blob)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		mode := f.mode
+		if mode == filemode.Empty {
+			mode = filemode.Regular
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: p, Mode: mode, Hash: hash})
+	}
+	for dir, dirFiles := range dirs {
+		hash, err := storeTestTree(s, dirFiles)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash})
+	}
+	// git sorts the entries as though directories have '/' appended to them
+	key := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool { return key(tree.Entries[i]) < key(tree.Entries[j]) })
+	eo := s.NewEncodedObject()
+	if err := tree.Encode(eo); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(eo)
+}
+
+func newTestSchema(t *testing.T) *Schema {
+	t.Helper()
+	return &Schema{
+		RootPath: t.TempDir(),
+		CR:       &invv1alpha1.Schema{Spec: invv1alpha1.SchemaSpec{Provider: "p", Version: "v1"}},
+	}
+}
+
+// listFiles returns the files under the directory, relative to it
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files := []string{}
+	if err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestCopyFilesRemovesFilesNotInTheTree(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSchema(t)
+	dir := filepath.Join(s.RootPath, "p", "v1")
+	if _, err := s.CopyFiles(ctx, newTestTree(t, map[string]testFile{
+		"a.yang":       {content: "module a;\n"},
+		"old/b.yang":   {content: "module b;\n"},
+		"old/c/d.yang": {content: "module d;\n"},
+	}), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFileName), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree := newTestTree(t, map[string]testFile{"a.yang": {content: "module a;\n"}})
+
+	// a dry run reports the files without removing them
+	result, err := s.CopyFiles(ctx, tree, &CopyOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"old/b.yang", "old/c/d.yang"}; !reflect.DeepEqual(result.Deleted, want) {
+		t.Errorf("deleted = %v, want %v", result.Deleted, want)
+	}
+	if got := listFiles(t, dir); len(got) != 4 {
+		t.Errorf("dry run removed files: %v", got)
+	}
+
+	result, err = s.CopyFiles(ctx, tree, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"old/b.yang", "old/c/d.yang"}; !reflect.DeepEqual(result.Deleted, want) || result.Unchanged != 1 {
+		t.Errorf("unexpected copy result: %+v", result)
+	}
+	// the manifest is kept, the emptied directories are removed
+	if got, want := listFiles(t, dir), []string{ManifestFileName, "a.yang"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Errorf("emptied directory is not removed: %v", err)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSchema(t)
+	dir := filepath.Join(s.RootPath, "p", "v1")
+	result, err := s.CopyFiles(ctx, newTestTree(t, map[string]testFile{
+		"a.yang":     {content: "module a;\n"},
+		"sub/b.yang": {content: "module b;\n"},
+		"run.sh":     {content: "#!/bin/sh\n", mode: filemode.Executable},
+		"link.yang":  {content: "a.yang", mode: filemode.Symlink},
+	}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{Files: result.Checksums}
+	if err := s.WriteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	m, err = ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := VerifyManifest(dir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.OK() || verified.Err() != nil {
+		t.Fatalf("files do not match the manifest: %+v", verified)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.yang"), []byte("module changed;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "sub", "b.yang")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "extra.yang"), []byte("module extra;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	verified, err = VerifyManifest(dir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ManifestVerifyResult{
+		Modified: []string{"a.yang", "run.sh"},
+		Missing:  []string{"sub/b.yang"},
+		Extra:    []string{"extra.yang"},
+	}
+	if !reflect.DeepEqual(verified, want) {
+		t.Errorf("verify result = %+v, want %+v", verified, want)
+	}
+	if err := verified.Err(); err == nil || !strings.Contains(err.Error(), "2 modified, 1 missing, 1 extra") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestValidateSymlink(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		valid  bool
+	}{
+		{name: "a", target: "b.yang", valid: true},
+		{name: "sub/a", target: "../b.yang", valid: true},
+		{name: "a", target: "", valid: false},
+		{name: "a", target: "/etc/passwd", valid: false},
+		{name: "a", target: "../b.yang", valid: false},
+		{name: "sub/a", target: "../../b.yang", valid: false},
+		{name: "a", target: "sub/../../b.yang", valid: false},
+		// escapes through symlinks are checked once the symlinks are written
+		{name: "a", target: "sub/b/..", valid: true},
+	}
+	for _, tc := range tests {
+		if err := validateSymlink(tc.name, tc.target); (err == nil) != tc.valid {
+			t.Errorf("validateSymlink(%q, %q) = %v, want valid %t", tc.name, tc.target, err, tc.valid)
+		}
+	}
+}
+
+func TestCopyFilesSymlinks(t *testing.T) {
+	tree := newTestTree(t, map[string]testFile{
+		"a.yang":    {content: "module a;\n"},
+		"run.sh":    {content: "#!/bin/sh\n", mode: filemode.Executable},
+		"link.yang": {content: "a.yang", mode: filemode.Symlink},
+		"abs":       {content: "/etc/passwd", mode: filemode.Symlink},
+		"up":        {content: "../v2/a.yang", mode: filemode.Symlink},
+		// sub/b resolves to the directory, so sub/b/.. to its parent
+		"sub/b":   {content: "..", mode: filemode.Symlink},
+		"chained": {content: "sub/b/..", mode: filemode.Symlink},
+	})
+	wantAdded := []string{"a.yang", "link.yang", "run.sh", "sub/b"}
+	wantFailed := []string{"abs", "chained", "up"}
+
+	for _, dryRun := range []bool{true, false} {
+		s := newTestSchema(t)
+		dir := filepath.Join(s.RootPath, "p", "v1")
+		res, err := s.CopyFiles(context.Background(), tree, &CopyOptions{DryRun: dryRun})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res.Added, wantAdded) {
+			t.Errorf("dry run %t: added %v, want %v", dryRun, res.Added, wantAdded)
+		}
+		if !reflect.DeepEqual(res.Failed, wantFailed) {
+			t.Errorf("dry run %t: failed %v, want %v", dryRun, res.Failed, wantFailed)
+		}
+		if dryRun {
+			if _, err := os.Lstat(dir); !os.IsNotExist(err) {
+				t.Errorf("dry run wrote the directory: %v", err)
+			}
+			continue
+		}
+		if got := listFiles(t, dir); !reflect.DeepEqual(got, wantAdded) {
+			t.Errorf("files %v, want %v", got, wantAdded)
+		}
+		fi, err := os.Stat(filepath.Join(dir, "run.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0755 {
+			t.Errorf("mode of run.sh = %v, want %v", fi.Mode().Perm(), os.FileMode(0755))
+		}
+		if target, err := os.Readlink(filepath.Join(dir, "link.yang")); err != nil || target != "a.yang" {
+			t.Errorf("target of link.yang = %q (%v), want %q", target, err, "a.yang")
+		}
+	}
+}
+
+func TestCopyFilesDoesNotFollowSymlinkedDirectories(t *testing.T) {
+	tree := newTestTree(t, map[string]testFile{
+		"a.yang":     {content: "module a;\n"},
+		"sub/b.yang": {content: "module b;\n"},
+	})
+	for _, dryRun := range []bool{true, false} {
+		s := newTestSchema(t)
+		dir := filepath.Join(s.RootPath, "p", "v1")
+		outside := t.TempDir()
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(outside, filepath.Join(dir, "sub")); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := s.CopyFiles(context.Background(), tree, &CopyOptions{DryRun: dryRun})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a.yang"}; !reflect.DeepEqual(res.Added, want) {
+			t.Errorf("dry run %t: added %v, want %v", dryRun, res.Added, want)
+		}
+		if want := []string{"sub/b.yang"}; !reflect.DeepEqual(res.Failed, want) {
+			t.Errorf("dry run %t: failed %v, want %v", dryRun, res.Failed, want)
+		}
+		if want := []string{"sub"}; !reflect.DeepEqual(res.Deleted, want) {
+			t.Errorf("dry run %t: deleted %v, want %v", dryRun, res.Deleted, want)
+		}
+		if got := listFiles(t, outside); len(got) != 0 {
+			t.Errorf("dry run %t: files written outside of the directory: %v", dryRun, got)
+		}
+	}
+}
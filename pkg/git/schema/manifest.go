@@ -0,0 +1,241 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+)
+
+// ManifestFileName is the name of the provenance manifest written into the
+// <provider>/<version> directory of a loaded schema
+const ManifestFileName = ".schema-manifest.json"
+
+// ErrManifestMismatch is returned when the files of a schema do not match its manifest
+var ErrManifestMismatch = errors.New("schema files do not match the manifest")
+
+// Manifest records where the files of a schema were loaded from and their checksums
+type Manifest struct {
+	// URL is the url of the repository
+	URL string `json:"url"`
+	// Ref is the branch or tag that was loaded
+	Ref string `json:"ref"`
+	// Commit is the commit the ref resolved to
+	Commit string `json:"commit"`
+	// Signer is the verified signer of the tag or commit; empty when the schema
+	// has no trust policy
+	Signer string `json:"signer,omitempty"`
+	// Trust is the trust policy the signer was verified with
+	Trust *invv1alpha1.SchemaSpecTrust `json:"trust,omitempty"`
+	// Directory is the directory within the repository the files were copied from
+	Directory string `json:"directory,omitempty"`
+	// Loaded is the time the schema was loaded
+	Loaded time.Time `json:"loaded"`
+	// Files holds the checksums of the files, sorted by path
+	Files []FileChecksum `json:"files"`
+	// Failed holds the files of the commit that could not be copied, sorted;
+	// they are not in the directory
+	Failed []string `json:"failed,omitempty"`
+}
+
+// FileChecksum holds the checksums of a file relative to the schema directory
+type FileChecksum struct {
+	Path string `json:"path"`
+	// Mode is the git file mode: regular, executable or symlink
+	Mode string `json:"mode"`
+	Size int64  `json:"size"`
+	// SHA256 is the hex encoded sha256 of the content; the content of a symlink is
+	// its target
+	SHA256 string `json:"sha256"`
+	// BlobHash is the git blob hash of the file in the commit; the hash of the
+	// pointer for files stored in Git LFS
+	BlobHash string `json:"blobHash"`
+	// LFS indicates the content was resolved from a Git LFS pointer
+	LFS bool `json:"lfs,omitempty"`
+}
+
+func newFileChecksum(path string, mode filemode.FileMode, content []byte) FileChecksum {
+	w := newChecksumWriter(path, mode, int64(len(content)))
+	w.Write(content)
+	return w.Checksum()
+}
+
+// checksumWriter computes the checksum of the content written to it; the size
+// of the content must be known to compute the blob hash.
+type checksumWriter struct {
+	path   string
+	mode   filemode.FileMode
+	size   int64
+	sha256 hash.Hash
+	blob   plumbing.Hasher
+}
+
+func newChecksumWriter(path string, mode filemode.FileMode, size int64) *checksumWriter {
+	return &checksumWriter{
+		path:   path,
+		mode:   mode,
+		sha256: sha256.New(),
+		blob:   plumbing.NewHasher(plumbing.BlobObject, size),
+	}
+}
+
+func (r *checksumWriter) Write(p []byte) (int, error) {
+	r.sha256.Write(p)
+	r.blob.Write(p)
+	r.size += int64(len(p))
+	return len(p), nil
+}
+
+// Checksum returns the checksum of the content written so far
+func (r *checksumWriter) Checksum() FileChecksum {
+	return FileChecksum{
+		Path:     r.path,
+		Mode:     r.mode.String(),
+		Size:     r.size,
+		SHA256:   hex.EncodeToString(r.sha256.Sum(nil)),
+		BlobHash: r.blob.Sum().String(),
+	}
+}
+
+// WriteManifest writes the manifest into the directory of the schema
+func (r *Schema) WriteManifest(m *Manifest) error {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := r.CR.Spec.GetBasePath(r.RootPath)
+	if err := os.WriteFile(filepath.Join(dir, ManifestFileName), append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest of the schema directory
+func ReadManifest(dir string) (*Manifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %w", err)
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("cannot read manifest %s: %w", filepath.Join(dir, ManifestFileName), err)
+	}
+	return m, nil
+}
+
+// ManifestVerifyResult describes the differences between the files of a schema
+// directory and its manifest; the paths are sorted.
+type ManifestVerifyResult struct {
+	// Modified holds the files whose content does not match the checksums
+	Modified []string
+	// Missing holds the files of the manifest that do not exist
+	Missing []string
+	// Extra holds the files that are not part of the manifest
+	Extra []string
+}
+
+// OK indicates the files match the manifest
+func (r *ManifestVerifyResult) OK() bool {
+	return len(r.Modified) == 0 && len(r.Missing) == 0 && len(r.Extra) == 0
+}
+
+// Err returns an error wrapping ErrManifestMismatch when the files do not match
+func (r *ManifestVerifyResult) Err() error {
+	if r.OK() {
+		return nil
+	}
+	return fmt.Errorf("%w: %d modified, %d missing, %d extra", ErrManifestMismatch, len(r.Modified), len(r.Missing), len(r.Extra))
+}
+
+// VerifyManifest compares the files in the directory with the checksums of the
+// manifest.
+func VerifyManifest(dir string, m *Manifest) (*ManifestVerifyResult, error) {
+	result := &ManifestVerifyResult{
+		Modified: []string{},
+		Missing:  []string{},
+		Extra:    []string{},
+	}
+	files := make(map[string]FileChecksum, len(m.Files))
+	for _, f := range m.Files {
+		files[f.Path] = f
+	}
+	seen := map[string]bool{}
+	if err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ManifestFileName {
+			return nil
+		}
+		expected, ok := files[rel]
+		if !ok {
+			result.Extra = append(result.Extra, rel)
+			return nil
+		}
+		seen[rel] = true
+		mode, content, err := readFileWithMode(p, d)
+		if err != nil {
+			return err
+		}
+		// the blob hash of a Git LFS pointer cannot be derived from the content
+		if actual := newFileChecksum(rel, mode, content); actual.Mode != expected.Mode || actual.Size != expected.Size || actual.SHA256 != expected.SHA256 {
+			result.Modified = append(result.Modified, rel)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for _, f := range m.Files {
+		if !seen[f.Path] {
+			result.Missing = append(result.Missing, f.Path)
+		}
+	}
+	sort.Strings(result.Modified)
+	sort.Strings(result.Missing)
+	sort.Strings(result.Extra)
+	return result, nil
+}
+
+// readFileWithMode returns the git file mode and the content of the file; the
+// content of a symlink is its target.
+func readFileWithMode(p string, d fs.DirEntry) (filemode.FileMode, []byte, error) {
+	if d.Type()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return filemode.Empty, nil, err
+		}
+		return filemode.Symlink, []byte(filepath.ToSlash(target)), nil
+	}
+	fi, err := d.Info()
+	if err != nil {
+		return filemode.Empty, nil, err
+	}
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return filemode.Empty, nil, err
+	}
+	return git.FileModeOf(fi.Mode()), content, nil
+}
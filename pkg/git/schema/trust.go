@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/sign"
+	"github.com/henderiw/git-loader/pkg/sign/pgp"
+	"github.com/henderiw/git-loader/pkg/sign/ssh"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const pgpArmorHeader = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+
+// GetTrustPolicy returns the trust policy of the schema or nil if the schema
+// does not define one. The trusted keys are read from the secret in the namespace
+// of the schema using the client and/or from the local keyring file.
+func (r *Schema) GetTrustPolicy(ctx context.Context, c client.Reader) (*git.TrustPolicy, error) {
+	trust := r.CR.Spec.Trust
+	if trust == nil {
+		return nil, nil
+	}
+
+	keyRings := [][]byte{}
+	if trust.KeyRingSecret != "" {
+		if c == nil {
+			return nil, fmt.Errorf("cannot read keyring secret %s/%s: no client", r.CR.Namespace, trust.KeyRingSecret)
+		}
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: r.CR.Namespace, Name: trust.KeyRingSecret}, secret); err != nil {
+			return nil, fmt.Errorf("cannot read keyring secret %s/%s: %w", r.CR.Namespace, trust.KeyRingSecret, err)
+		}
+		keys := make([]string, 0, len(secret.Data))
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			keyRings = append(keyRings, secret.Data[k])
+		}
+	}
+	if trust.KeyRingFile != "" {
+		b, err := os.ReadFile(trust.KeyRingFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read keyring file %s: %w", trust.KeyRingFile, err)
+		}
+		keyRings = append(keyRings, b)
+	}
+
+	verifiers := make([]sign.Verifier, 0, len(keyRings))
+	for _, keyRing := range keyRings {
+		verifier, err := newVerifier(keyRing)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+
+	policy := &git.TrustPolicy{
+		AllowUnsigned:        trust.AllowUnsigned,
+		AllowLightweightTags: trust.AllowLightweightTags,
+	}
+	if len(verifiers) != 0 {
+		policy.Verifier = sign.NewChainVerifier(verifiers)
+	}
+	return policy, nil
+}
+
+// newVerifier returns a verifier for an armored OpenPGP keyring or ssh public keys
+// in authorized_keys format.
+func newVerifier(keyRing []byte) (sign.Verifier, error) {
+	if bytes.Contains(keyRing, []byte(pgpArmorHeader)) {
+		return pgp.NewVerifierFromArmoredKeyRing(keyRing)
+	}
+	return ssh.NewVerifierFromAuthorizedKeys(keyRing)
+}
+
+// GetCondition returns the ready condition of the schema for the result of loading
+// the schema; signature verification failures are reported as an untrusted source.
+func GetCondition(err error) invv1alpha1.Condition {
+	switch {
+	case err == nil:
+		return invv1alpha1.Ready()
+	case errors.Is(err, sign.ErrUnsigned), errors.Is(err, sign.ErrUntrusted):
+		return invv1alpha1.Failed(fmt.Sprintf("untrusted source: %s", err))
+	default:
+		return invv1alpha1.Failed(err.Error())
+	}
+}
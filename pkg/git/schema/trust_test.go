@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	invv1alpha1 "github.com/henderiw/git-loader/apis/inv/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/sign"
+)
+
+func TestGetCondition(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err     error
+		reason  invv1alpha1.ConditionReason
+		message string
+	}{
+		"loaded":    {reason: invv1alpha1.ConditionReasonReady},
+		"failed":    {err: errors.New("boom"), reason: invv1alpha1.ConditionReasonFailed, message: "boom"},
+		"unsigned":  {err: fmt.Errorf("tag v1: %w", sign.ErrUnsigned), reason: invv1alpha1.ConditionReasonFailed, message: "untrusted source: "},
+		"untrusted": {err: fmt.Errorf("commit abc: %w", sign.ErrUntrusted), reason: invv1alpha1.ConditionReasonFailed, message: "untrusted source: "},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cond := GetCondition(tc.err)
+			if cond.Reason != string(tc.reason) {
+				t.Errorf("reason = %s, want %s", cond.Reason, tc.reason)
+			}
+			if !strings.HasPrefix(cond.Message, tc.message) {
+				t.Errorf("message = %q, want prefix %q", cond.Message, tc.message)
+			}
+		})
+	}
+}
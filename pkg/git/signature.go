@@ -0,0 +1,191 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/henderiw/git-loader/pkg/sign"
+	"github.com/henderiw/logger/log"
+)
+
+// TrustPolicy defines which signatures are trusted when reading from the repository.
+type TrustPolicy struct {
+	// Verifier verifies the signatures against the trusted keys
+	Verifier sign.Verifier
+	// AllowUnsigned allows reading tags and commits without a signature;
+	// signatures that are present must still be trusted, including the
+	// signature of the commit an unsigned annotated tag points to
+	AllowUnsigned bool
+	// AllowLightweightTags allows reading lightweight tags, which cannot be signed,
+	// in which case the signature of the commit the tag points to is verified
+	AllowLightweightTags bool
+}
+
+// signCommit signs the commit with the signer of the repository, if any.
+func (r *gitRepository) signCommit(commit *object.Commit) error {
+	if r.signer == nil {
+		return nil
+	}
+	eo := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(eo); err != nil {
+		return err
+	}
+	message, err := readEncodedObject(eo)
+	if err != nil {
+		return err
+	}
+	sig, err := r.signer.Sign(message)
+	if err != nil {
+		return fmt.Errorf("cannot sign commit: %w", err)
+	}
+	commit.PGPSignature = string(sig)
+	return nil
+}
+
+// signTag signs the annotated tag with the signer of the repository, if any.
+func (r *gitRepository) signTag(tag *object.Tag) error {
+	if r.signer == nil {
+		return nil
+	}
+	eo := &plumbing.MemoryObject{}
+	if err := tag.EncodeWithoutSignature(eo); err != nil {
+		return err
+	}
+	message, err := readEncodedObject(eo)
+	if err != nil {
+		return err
+	}
+	sig, err := r.signer.Sign(message)
+	if err != nil {
+		return fmt.Errorf("cannot sign tag: %w", err)
+	}
+	tag.PGPSignature = string(sig)
+	return nil
+}
+
+// getVerifiedCommit returns the commit of the ref after verifying the signature of
+// the tag or commit with the trust policy of the repository. It returns the signer
+// or an empty string if the ref is not verified or unsigned.
+func (r *gitRepository) getVerifiedCommit(ctx context.Context, ref RefName) (*object.Commit, string, error) {
+	log := log.FromContext(ctx)
+	branch, err := r.verifyRef(ctx, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	if branch {
+		commit, err := r.getCommitFromBranch(ctx, ref.RefInLocal())
+		if err != nil {
+			return nil, "", err
+		}
+		signer, err := r.verifyCommit(commit)
+		if err != nil {
+			return nil, "", err
+		}
+		return commit, signer, nil
+	}
+
+	tagRef, err := r.repo.Reference(ref.TagInLocal(), false)
+	if err != nil {
+		return nil, "", err
+	}
+	tag, err := r.repo.TagObject(tagRef.Hash())
+	switch {
+	case err == plumbing.ErrObjectNotFound:
+		// lightweight tag, pointing to a commit
+		if r.trustPolicy != nil && !r.trustPolicy.AllowLightweightTags {
+			return nil, "", fmt.Errorf("tag %q: %w: lightweight tags are not allowed", ref, sign.ErrUnsigned)
+		}
+		commit, err := r.repo.CommitObject(tagRef.Hash())
+		if err != nil {
+			return nil, "", err
+		}
+		signer, err := r.verifyCommit(commit)
+		if err != nil {
+			return nil, "", err
+		}
+		return commit, signer, nil
+	case err != nil:
+		return nil, "", err
+	}
+
+	commit, err := tag.Commit()
+	if err != nil {
+		return nil, "", err
+	}
+	if r.trustPolicy == nil {
+		return commit, "", nil
+	}
+	if tag.PGPSignature == "" {
+		// like a lightweight tag, an allowed unsigned annotated tag is trusted
+		// based on the commit signature
+		if !r.trustPolicy.AllowUnsigned {
+			return nil, "", fmt.Errorf("tag %q: %w", ref, sign.ErrUnsigned)
+		}
+		log.Debug("tag is not signed, verifying commit", "tag", ref, "commit", commit.Hash.String())
+		signer, err := r.verifyCommit(commit)
+		if err != nil {
+			return nil, "", err
+		}
+		return commit, signer, nil
+	}
+	signer, err := verifyTag(r.trustPolicy.Verifier, tag)
+	if err != nil {
+		return nil, "", err
+	}
+	return commit, signer, nil
+}
+
+// verifyCommit verifies the signature of the commit with the trust policy of the
+// repository and returns the signer. When the repository has no trust policy the
+// commit is not verified.
+func (r *gitRepository) verifyCommit(commit *object.Commit) (string, error) {
+	if r.trustPolicy == nil {
+		return "", nil
+	}
+	if commit.PGPSignature == "" {
+		if r.trustPolicy.AllowUnsigned {
+			return "", nil
+		}
+		return "", fmt.Errorf("commit %s: %w", commit.Hash, sign.ErrUnsigned)
+	}
+	eo := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(eo); err != nil {
+		return "", err
+	}
+	return verifySignature(r.trustPolicy.Verifier, eo, commit.PGPSignature, fmt.Sprintf("commit %s", commit.Hash))
+}
+
+func verifyTag(verifier sign.Verifier, tag *object.Tag) (string, error) {
+	eo := &plumbing.MemoryObject{}
+	if err := tag.EncodeWithoutSignature(eo); err != nil {
+		return "", err
+	}
+	return verifySignature(verifier, eo, tag.PGPSignature, fmt.Sprintf("tag %s", tag.Name))
+}
+
+func verifySignature(verifier sign.Verifier, eo plumbing.EncodedObject, signature, name string) (string, error) {
+	if verifier == nil {
+		return "", fmt.Errorf("%s: %w: no trusted keys", name, sign.ErrUntrusted)
+	}
+	message, err := readEncodedObject(eo)
+	if err != nil {
+		return "", err
+	}
+	signer, err := verifier.Verify(message, []byte(signature))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return signer, nil
+}
+
+func readEncodedObject(eo plumbing.EncodedObject) ([]byte, error) {
+	rd, err := eo.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	return io.ReadAll(rd)
+}
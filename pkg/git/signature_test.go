@@ -0,0 +1,71 @@
+package git_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+	"github.com/henderiw/git-loader/pkg/sign/pgp"
+)
+
+func TestCommitIsSigned(t *testing.T) {
+	_, remote, url := newTestRemote(t, nil)
+	entity, err := openpgp.NewEntity("signer", "", "signer@localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	repo, err := git.OpenRepository(ctx, t.TempDir(), &configv1alpha1.GitRepository{
+		URL:         url,
+		Credentials: "credentials",
+	}, &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+		RetryPolicy:        &git.RetryPolicy{MaxAttempts: 1},
+		Signer:             pgp.NewSigner(entity),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+
+	ref := workspaceRef("pkg", "ws")
+	committed, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Push(ctx, ref, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature is verified by go-git with the public key of the signer
+	commit, err := remote.CommitObject(committed.Commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.PGPSignature == "" {
+		t.Fatal("commit is not signed")
+	}
+	var keyRing bytes.Buffer
+	w, err := armor.Encode(&keyRing, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := commit.Verify(keyRing.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.PrimaryKey.KeyId != entity.PrimaryKey.KeyId {
+		t.Errorf("commit is signed by %s, want %s", signer.PrimaryKey.KeyIdString(), entity.PrimaryKey.KeyIdString())
+	}
+}
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TagInfo describes a tag of the repository
+type TagInfo struct {
+	// Name is the relative name of the tag (e.g. v1.0.0)
+	Name string
+	// Commit is the commit the tag points to
+	Commit plumbing.Hash
+	// Annotated indicates the tag is a tag object rather than a lightweight tag
+	Annotated bool
+	// Signed indicates the tag object carries a signature
+	Signed bool
+	// Signer is the verified signer of the tag or of its commit; only set when
+	// the repository has a trust policy
+	Signer string
+	// VerifyErr holds the reason the tag is not trusted by the trust policy
+	VerifyErr error
+}
+
+// Tags returns the tags of the repository sorted by name. When the repository
+// has a trust policy, every tag is verified; a tag that is not trusted is
+// reported with the reason instead of failing the listing.
+func (r *gitRepository) Tags(ctx context.Context) ([]TagInfo, error) {
+	ctx, span := tracer.Start(ctx, "gitRepository::Tags", trace.WithAttributes())
+	defer span.End()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	refs, err := r.repo.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	var tags []TagInfo
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !strings.HasPrefix(ref.Name().String(), tagsPrefixInLocalRepo) {
+			return nil
+		}
+		info := TagInfo{
+			Name: strings.TrimPrefix(ref.Name().String(), tagsPrefixInLocalRepo),
+		}
+		tag, err := r.repo.TagObject(ref.Hash())
+		switch err {
+		case nil:
+			commit, err := tag.Commit()
+			if err != nil {
+				return err
+			}
+			info.Annotated = true
+			info.Signed = tag.PGPSignature != ""
+			info.Commit = commit.Hash
+		case plumbing.ErrObjectNotFound:
+			info.Commit = ref.Hash()
+		default:
+			return err
+		}
+		if r.trustPolicy != nil {
+			_, info.Signer, info.VerifyErr = r.getVerifiedCommit(ctx, RefName(info.Name))
+		}
+		tags = append(tags, info)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
@@ -0,0 +1,123 @@
+package git_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+// tempObjects returns the temporary pack files of the cached repositories under root
+func tempObjects(t *testing.T, root string) []string {
+	t.Helper()
+	dirs, _ := cacheDirs(t, root)
+	var tmp []string
+	for _, dir := range dirs {
+		des, err := os.ReadDir(filepath.Join(dir, "objects", "pack"))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		for _, de := range des {
+			if strings.HasPrefix(de.Name(), "tmp_") {
+				tmp = append(tmp, de.Name())
+			}
+		}
+	}
+	return tmp
+}
+
+func TestFetchTimeout(t *testing.T) {
+	srv, remote, url := newTestRemote(t, nil)
+	ctx := context.Background()
+	root := t.TempDir()
+	repoCfg := &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}
+	opts := &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+		RetryPolicy:        &git.RetryPolicy{MaxAttempts: 1},
+	}
+	repo, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Close(ctx)
+
+	// the pack of the new commit is only sent in part
+	if _, err := gittest.CommitFiles(remote, "main", map[string]string{"large.yaml": randomContent(t, 1<<20)}, "large"); err != nil {
+		t.Fatal(err)
+	}
+	for name, open := range map[string]func() error{
+		"timeout": func() error {
+			timeoutOpts := *opts
+			timeoutOpts.FetchTimeout = 200 * time.Millisecond
+			_, err := git.OpenRepository(ctx, root, repoCfg, &timeoutOpts)
+			return err
+		},
+		"cancel": func() error {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			time.AfterFunc(200*time.Millisecond, cancel)
+			_, err := git.OpenRepository(ctx, root, repoCfg, opts)
+			return err
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv.Stall(transport.UploadPackServiceName, 1)
+			err := open()
+			if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected the fetch to be stopped, got %v", err)
+			}
+			if tmp := tempObjects(t, root); len(tmp) != 0 {
+				t.Errorf("temporary objects were not removed: %v", tmp)
+			}
+		})
+	}
+
+	// the repository is fetched once the remote responds
+	repo, err = git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+	if got := readFile(t, repo, "main", "large.yaml"); len(got) != 1<<20 {
+		t.Errorf("size of large.yaml = %d, want %d", len(got), 1<<20)
+	}
+}
+
+func TestPushTimeout(t *testing.T) {
+	srv, remote, url := newTestRemote(t, nil)
+	ctx := context.Background()
+	repo, err := git.OpenRepository(ctx, t.TempDir(), &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}, &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+		RetryPolicy:        &git.RetryPolicy{MaxAttempts: 1},
+		PushTimeout:        200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+	ref := workspaceRef("pkg", "ws")
+	if _, err := repo.Commit(ctx, ref, "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Stall(transport.ReceivePackServiceName, 1)
+	if _, err := repo.Push(ctx, ref, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the push to time out, got %v", err)
+	}
+	if _, err := remote.Reference(plumbing.NewBranchReferenceName("pkg/ws"), false); err == nil {
+		t.Errorf("the stalled push updated the remote branch")
+	}
+	// the push succeeds once the remote responds
+	if _, err := repo.Push(ctx, ref, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,186 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/henderiw/logger/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Verify checks the integrity of the cached repository: the origin URL, HEAD and
+// the objects the references point to.
+func (r *gitRepository) Verify(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "gitRepository::Verify", trace.WithAttributes())
+	defer span.End()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return verifyRepository(r.repo, r.url)
+}
+
+// Repair quarantines the cached repository and clones it again. Local references
+// that were not pushed are only kept in the quarantined copy, which is restored
+// when the repository cannot be cloned again. The cached repository is moved,
+// so it is not repaired while it is open elsewhere, in this or in another
+// process.
+func (r *gitRepository) Repair(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "gitRepository::Repair", trace.WithAttributes())
+	defer span.End()
+	// the objects are replaced -> wait for the walks of List and Archive to end
+	defer r.walks.startRemoval()()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if r.dir == "" {
+		repo, fetchedRefs := r.repo, r.fetchedRefs
+		if err := r.reclone(ctx); err != nil {
+			r.repo, r.fetchedRefs = repo, fetchedRefs
+			return err
+		}
+		return nil
+	}
+	return withExclusiveUse(ctx, r.dir, r.use, func() error {
+		quarantine, err := quarantineRepository(ctx, r.dir)
+		if err != nil {
+			return err
+		}
+		if err := r.reclone(ctx); err != nil {
+			if rerr := restoreRepository(ctx, r.dir, quarantine); rerr != nil {
+				return fmt.Errorf("%w; %w", err, rerr)
+			}
+			repo, rerr := openRepository(r.dir)
+			if rerr != nil {
+				return fmt.Errorf("%w; %w", err, rerr)
+			}
+			r.repo = repo
+			return err
+		}
+		return nil
+	})
+}
+
+// reclone replaces the repository by an empty one and fetches it
+func (r *gitRepository) reclone(ctx context.Context) error {
+	var repo *git.Repository
+	var err error
+	if r.dir == "" {
+		repo, err = initMemoryRepository()
+	} else {
+		repo, err = initEmptyRepository(r.dir)
+	}
+	if err != nil {
+		return fmt.Errorf("error cloning git repository %q: %w", r.url, err)
+	}
+	if err := initializeOrigin(repo, r.url); err != nil {
+		return fmt.Errorf("error cloning git repository %q, cannot create remote: %v", r.url, err)
+	}
+	r.repo = repo
+	r.fetchedRefs = nil
+	return r.fetchRemoteRepository(ctx)
+}
+
+// verifyRepository checks the origin URL and HEAD of the repository and runs a
+// quick connectivity check: every reference must point to an existing object and
+// the commits must have a readable root tree.
+func verifyRepository(repo *git.Repository, url string) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("cannot read config: %w", err)
+	}
+	remote, ok := cfg.Remotes[OriginName]
+	if !ok || len(remote.URLs) == 0 {
+		return fmt.Errorf("remote %q not found", OriginName)
+	}
+	if remote.URLs[0] != url {
+		return fmt.Errorf("remote %q url mismatch: got %q, want %q", OriginName, remote.URLs[0], url)
+	}
+
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return fmt.Errorf("cannot read HEAD: %w", err)
+	}
+	if head.Type() != plumbing.SymbolicReference || head.Target() != DefaultMainReferenceName {
+		return fmt.Errorf("unexpected HEAD %s", head.String())
+	}
+
+	refs, err := repo.Storer.IterReferences()
+	if err != nil {
+		return fmt.Errorf("cannot read references: %w", err)
+	}
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		if err := verifyObject(repo.Storer, ref.Hash()); err != nil {
+			return fmt.Errorf("reference %s: %w", ref.Name(), err)
+		}
+		return nil
+	})
+}
+
+// verifyObject checks the object exists; for commits the root tree is checked
+// and for tags the tagged object.
+func verifyObject(s storer.EncodedObjectStorer, hash plumbing.Hash) error {
+	obj, err := object.GetObject(s, hash)
+	if err != nil {
+		return fmt.Errorf("cannot read object %s: %w", hash, err)
+	}
+	switch o := obj.(type) {
+	case *object.Commit:
+		if _, err := o.Tree(); err != nil {
+			return fmt.Errorf("cannot read tree %s of commit %s: %w", o.TreeHash, o.Hash, err)
+		}
+	case *object.Tag:
+		return verifyObject(s, o.Target)
+	}
+	return nil
+}
+
+// quarantineRepository moves the cached repository aside such that it can be
+// inspected later and returns the quarantined directory. Only the latest
+// quarantined copy of a repository is kept; the earlier ones are removed.
+func quarantineRepository(ctx context.Context, dir string) (string, error) {
+	log := log.FromContext(ctx)
+	earlier, err := filepath.Glob(dir + quarantineSuffix + "*")
+	if err != nil {
+		return "", err
+	}
+	quarantine := fmt.Sprintf("%s%s%d", dir, quarantineSuffix, time.Now().UnixNano())
+	if err := os.Rename(dir, quarantine); err != nil {
+		return "", fmt.Errorf("cannot quarantine cached repository %s: %w", dir, err)
+	}
+	log.Info("quarantined cached repository", "dir", dir, "quarantine", quarantine)
+	for _, d := range earlier {
+		if err := os.RemoveAll(d); err != nil {
+			log.Error("cannot remove quarantined repository", "dir", d, "error", err)
+		}
+	}
+	return quarantine, nil
+}
+
+// restoreRepository moves the quarantined repository back in place of the
+// cached repository
+func restoreRepository(ctx context.Context, dir, quarantine string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("cannot restore cached repository %s: %w", dir, err)
+	}
+	if err := os.Rename(quarantine, dir); err != nil {
+		return fmt.Errorf("cannot restore cached repository %s: %w", dir, err)
+	}
+	log.FromContext(ctx).Info("restored quarantined repository", "dir", dir, "quarantine", quarantine)
+	return nil
+}
@@ -0,0 +1,152 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	configv1alpha1 "github.com/henderiw/git-loader/apis/config/v1alpha1"
+	"github.com/henderiw/git-loader/pkg/git"
+	"github.com/henderiw/git-loader/pkg/git/gittest"
+)
+
+// cacheDirs returns the cached and the quarantined repositories under root
+func cacheDirs(t *testing.T, root string) ([]string, []string) {
+	t.Helper()
+	des, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs, quarantined []string
+	for _, de := range des {
+		if !de.IsDir() {
+			continue
+		}
+		if strings.Contains(de.Name(), ".quarantine-") {
+			quarantined = append(quarantined, filepath.Join(root, de.Name()))
+		} else {
+			dirs = append(dirs, filepath.Join(root, de.Name()))
+		}
+	}
+	return dirs, quarantined
+}
+
+func TestRepair(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	ctx := context.Background()
+	root := t.TempDir()
+	repoCfg := &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}
+	opts := &git.Options{CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword)}
+
+	repo, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+	if err := repo.Verify(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cached repository is not moved while another repository has it open
+	other, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Repair(ctx); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("repair of a repository in use: error = %v", err)
+	}
+	other.Close(ctx)
+
+	for i := 0; i < 2; i++ {
+		if err := repo.Repair(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Verify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, repo, "main", "README.md"); got != "readme\n" {
+		t.Errorf("content of README.md = %q, want %q", got, "readme\n")
+	}
+	// only the latest quarantined copy is kept
+	if _, quarantined := cacheDirs(t, root); len(quarantined) != 1 {
+		t.Errorf("quarantined repositories = %v, want 1", quarantined)
+	}
+}
+
+func TestRepairRestoresTheRepositoryWhenTheFetchFails(t *testing.T) {
+	srv, _, url := newTestRemote(t, nil)
+	ctx := context.Background()
+	root := t.TempDir()
+	repo, err := git.OpenRepository(ctx, root, &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}, &git.Options{
+		CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword),
+		RetryPolicy:        &git.RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+	committed, err := repo.Commit(ctx, workspaceRef("pkg", "ws"), "pkg", "ws", "v1", map[string]string{"c.yaml": "c: 1\n"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SetCredentials(testUsername, "rotated")
+	if err := repo.Repair(ctx); err == nil {
+		t.Fatal("repair without access to the remote succeeded")
+	}
+	// the unpushed commit is kept in the restored repository
+	info, err := repo.Resolve(ctx, "pkg/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Commit != committed.Commit {
+		t.Errorf("pkg/ws resolves to %s, want %s", info.Commit, committed.Commit)
+	}
+	if _, quarantined := cacheDirs(t, root); len(quarantined) != 0 {
+		t.Errorf("quarantined repositories = %v, want none", quarantined)
+	}
+}
+
+func TestOpenRepositoryQuarantinesACorruptedCache(t *testing.T) {
+	_, _, url := newTestRemote(t, nil)
+	ctx := context.Background()
+	root := t.TempDir()
+	repoCfg := &configv1alpha1.GitRepository{URL: url, Credentials: "credentials"}
+	opts := &git.Options{CredentialResolver: gittest.NewCredentialResolver(testUsername, testPassword)}
+
+	repo, err := git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs, _ := cacheDirs(t, root)
+	if len(dirs) != 1 {
+		t.Fatalf("cached repositories = %v, want 1", dirs)
+	}
+	if err := os.RemoveAll(filepath.Join(dirs[0], "objects")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Verify(ctx); err == nil {
+		t.Fatal("verification of a corrupted repository succeeded")
+	}
+
+	// the corrupted repository is open and cannot be moved
+	if _, err := git.OpenRepository(ctx, root, repoCfg, opts); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("open of a corrupted repository in use: error = %v", err)
+	}
+	repo.Close(ctx)
+
+	repo, err = git.OpenRepository(ctx, root, repoCfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close(ctx)
+	if err := repo.Verify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, quarantined := cacheDirs(t, root); len(quarantined) != 1 {
+		t.Errorf("quarantined repositories = %v, want 1", quarantined)
+	}
+}
@@ -0,0 +1,86 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/henderiw/git-loader/pkg/sign"
+)
+
+// NewSigner returns an OpenPGP signer using the private key of the entity.
+func NewSigner(entity *openpgp.Entity) sign.Signer {
+	return &pgpSigner{
+		entity: entity,
+	}
+}
+
+// NewSignerFromArmoredKey returns an OpenPGP signer using the first entity of an
+// armored private key; the passphrase is used to decrypt the key if it is encrypted.
+func NewSignerFromArmoredKey(key, passphrase []byte) (sign.Signer, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read openpgp key: %w", err)
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return nil, fmt.Errorf("cannot read openpgp key: no private key found")
+	}
+	entity := entities[0]
+	if entity.PrivateKey.Encrypted {
+		if err := entity.DecryptPrivateKeys(passphrase); err != nil {
+			return nil, fmt.Errorf("cannot decrypt openpgp key: %w", err)
+		}
+	}
+	return NewSigner(entity), nil
+}
+
+type pgpSigner struct {
+	entity *openpgp.Entity
+}
+
+var _ sign.Signer = &pgpSigner{}
+
+func (r *pgpSigner) Sign(message []byte) ([]byte, error) {
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, r.entity, bytes.NewReader(message), nil); err != nil {
+		return nil, fmt.Errorf("cannot sign with openpgp key %s: %w", r.entity.PrimaryKey.KeyIdString(), err)
+	}
+	return sig.Bytes(), nil
+}
+
+// NewVerifier returns an OpenPGP verifier that trusts the keys in the keyring.
+func NewVerifier(keyring openpgp.EntityList) sign.Verifier {
+	return &pgpVerifier{
+		keyring: keyring,
+	}
+}
+
+// NewVerifierFromArmoredKeyRing returns an OpenPGP verifier that trusts the keys
+// in the armored keyring.
+func NewVerifierFromArmoredKeyRing(keyring []byte) (sign.Verifier, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyring))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read openpgp keyring: %w", err)
+	}
+	return NewVerifier(entities), nil
+}
+
+type pgpVerifier struct {
+	keyring openpgp.EntityList
+}
+
+var _ sign.Verifier = &pgpVerifier{}
+
+func (r *pgpVerifier) Verify(message, signature []byte) (string, error) {
+	if len(signature) == 0 {
+		return "", sign.ErrUnsigned
+	}
+	entity, err := openpgp.CheckArmoredDetachedSignature(r.keyring, bytes.NewReader(message), bytes.NewReader(signature), nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", sign.ErrUntrusted, err.Error())
+	}
+	if id := entity.PrimaryIdentity(); id != nil {
+		return fmt.Sprintf("%s (%s)", id.Name, entity.PrimaryKey.KeyIdString()), nil
+	}
+	return entity.PrimaryKey.KeyIdString(), nil
+}
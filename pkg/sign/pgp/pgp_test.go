@@ -0,0 +1,68 @@
+package pgp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/henderiw/git-loader/pkg/sign"
+)
+
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, "", name+"@localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+// armoredPublicKey returns the armored public key of the entity
+func armoredPublicKey(t *testing.T, entity *openpgp.Entity) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w, err := armor.Encode(&b, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestSignVerify(t *testing.T) {
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nmessage\n")
+	entity := newTestEntity(t, "signer")
+	signature, err := NewSigner(entity).Sign(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewVerifierFromArmoredKeyRing(armoredPublicKey(t, entity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := verifier.Verify(message, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "signer <signer@localhost> (" + entity.PrimaryKey.KeyIdString() + ")"; signer != want {
+		t.Errorf("signer = %q, want %q", signer, want)
+	}
+
+	if _, err := verifier.Verify([]byte("tampered\n"), signature); !errors.Is(err, sign.ErrUntrusted) {
+		t.Errorf("verify of a tampered message: expected %v, got %v", sign.ErrUntrusted, err)
+	}
+	other := NewVerifier(openpgp.EntityList{newTestEntity(t, "other")})
+	if _, err := other.Verify(message, signature); !errors.Is(err, sign.ErrUntrusted) {
+		t.Errorf("verify with another key: expected %v, got %v", sign.ErrUntrusted, err)
+	}
+	if _, err := verifier.Verify(message, nil); !errors.Is(err, sign.ErrUnsigned) {
+		t.Errorf("verify without signature: expected %v, got %v", sign.ErrUnsigned, err)
+	}
+}
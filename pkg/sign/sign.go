@@ -0,0 +1,65 @@
+package sign
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUnsigned is returned when an object that must be signed has no signature
+	ErrUnsigned = errors.New("object is not signed")
+	// ErrUntrusted is returned when the signature of an object cannot be verified
+	// with any of the trusted keys
+	ErrUntrusted = errors.New("signature is not trusted")
+)
+
+// Signer signs the encoded (unsigned) git commit or tag objects
+type Signer interface {
+	// Sign returns the armored signature over the message
+	Sign(message []byte) ([]byte, error)
+}
+
+// Verifier verifies the signature of encoded (unsigned) git commit or tag objects
+type Verifier interface {
+	// Verify verifies the armored signature over the message and returns
+	// the identity of the signer (e.g. key id or fingerprint).
+	Verify(message, signature []byte) (string, error)
+}
+
+// NewChainVerifier returns a verifier that accepts a signature if any of
+// the verifiers in the chain accepts it.
+func NewChainVerifier(verifierChain []Verifier) Verifier {
+	return &chainVerifier{
+		verifierChain: verifierChain,
+	}
+}
+
+type chainVerifier struct {
+	verifierChain []Verifier
+}
+
+var _ Verifier = &chainVerifier{}
+
+func (r *chainVerifier) Verify(message, signature []byte) (string, error) {
+	var errs []error
+	for _, verifier := range r.verifierChain {
+		signer, err := verifier.Verify(message, signature)
+		if err == nil {
+			return signer, nil
+		}
+		errs = append(errs, err)
+	}
+	switch len(errs) {
+	case 0:
+		return "", fmt.Errorf("%w: no trusted keys", ErrUntrusted)
+	case 1:
+		return "", errs[0]
+	default:
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return "", fmt.Errorf("%w: %s", ErrUntrusted, strings.Join(msgs, "; "))
+	}
+}
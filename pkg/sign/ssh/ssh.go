@@ -0,0 +1,200 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"fmt"
+	"hash"
+
+	"github.com/henderiw/git-loader/pkg/sign"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ssh signatures follow the SSHSIG format of openssh (PROTOCOL.sshsig), which
+// is the format git uses for gpg.format=ssh.
+const (
+	sigMagic         = "SSHSIG"
+	sigVersion       = 1
+	sigNamespace     = "git"
+	sigHashAlgorithm = "sha512"
+	sigPEMType       = "SSH SIGNATURE"
+)
+
+// signedData is the blob that is signed by the ssh key
+type signedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// wrappedSignature is the blob that is armored as the signature
+type wrappedSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// NewSigner returns an ssh signer using the provided ssh key.
+func NewSigner(signer gossh.Signer) sign.Signer {
+	return &sshSigner{
+		signer: signer,
+	}
+}
+
+// NewSignerFromPrivateKey returns an ssh signer using a PEM encoded private key;
+// the passphrase is used to decrypt the key if it is encrypted.
+func NewSignerFromPrivateKey(key, passphrase []byte) (sign.Signer, error) {
+	var signer gossh.Signer
+	var err error
+	if len(passphrase) == 0 {
+		signer, err = gossh.ParsePrivateKey(key)
+	} else {
+		signer, err = gossh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ssh key: %w", err)
+	}
+	return NewSigner(signer), nil
+}
+
+type sshSigner struct {
+	signer gossh.Signer
+}
+
+var _ sign.Signer = &sshSigner{}
+
+func (r *sshSigner) Sign(message []byte) ([]byte, error) {
+	data, err := getSignedData(sigHashAlgorithm, message)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *gossh.Signature
+	// rsa keys must use rsa-sha2-512 as ssh-rsa (sha1) is not allowed
+	if as, ok := r.signer.(gossh.AlgorithmSigner); ok && r.signer.PublicKey().Type() == gossh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, gossh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = r.signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot sign with ssh key %s: %w", gossh.FingerprintSHA256(r.signer.PublicKey()), err)
+	}
+
+	blob := append([]byte(sigMagic), gossh.Marshal(wrappedSignature{
+		Version:       sigVersion,
+		PublicKey:     r.signer.PublicKey().Marshal(),
+		Namespace:     sigNamespace,
+		HashAlgorithm: sigHashAlgorithm,
+		Signature:     gossh.Marshal(sig),
+	})...)
+	return pem.EncodeToMemory(&pem.Block{Type: sigPEMType, Bytes: blob}), nil
+}
+
+// NewVerifier returns an ssh verifier that trusts the provided public keys.
+func NewVerifier(keys []gossh.PublicKey) sign.Verifier {
+	return &sshVerifier{
+		keys: keys,
+	}
+}
+
+// NewVerifierFromAuthorizedKeys returns an ssh verifier that trusts the public keys
+// in authorized_keys format (one key per line).
+func NewVerifierFromAuthorizedKeys(b []byte) (sign.Verifier, error) {
+	keys := []gossh.PublicKey{}
+	for len(bytes.TrimSpace(b)) > 0 {
+		key, _, _, rest, err := gossh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read ssh public keys: %w", err)
+		}
+		keys = append(keys, key)
+		b = rest
+	}
+	return NewVerifier(keys), nil
+}
+
+type sshVerifier struct {
+	keys []gossh.PublicKey
+}
+
+var _ sign.Verifier = &sshVerifier{}
+
+func (r *sshVerifier) Verify(message, signature []byte) (string, error) {
+	if len(signature) == 0 {
+		return "", sign.ErrUnsigned
+	}
+	block, _ := pem.Decode(signature)
+	if block == nil || block.Type != sigPEMType {
+		return "", fmt.Errorf("%w: not an ssh signature", sign.ErrUntrusted)
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(sigMagic)) {
+		return "", fmt.Errorf("%w: invalid ssh signature magic", sign.ErrUntrusted)
+	}
+	wsig := wrappedSignature{}
+	if err := gossh.Unmarshal(block.Bytes[len(sigMagic):], &wsig); err != nil {
+		return "", fmt.Errorf("%w: invalid ssh signature: %s", sign.ErrUntrusted, err.Error())
+	}
+	if wsig.Version != sigVersion {
+		return "", fmt.Errorf("%w: unsupported ssh signature version %d", sign.ErrUntrusted, wsig.Version)
+	}
+	if wsig.Namespace != sigNamespace {
+		return "", fmt.Errorf("%w: unexpected ssh signature namespace %q", sign.ErrUntrusted, wsig.Namespace)
+	}
+	pub, err := gossh.ParsePublicKey(wsig.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid ssh public key: %s", sign.ErrUntrusted, err.Error())
+	}
+	if !r.isTrusted(pub) {
+		return "", fmt.Errorf("%w: ssh key %s is not trusted", sign.ErrUntrusted, gossh.FingerprintSHA256(pub))
+	}
+	sig := &gossh.Signature{}
+	if err := gossh.Unmarshal(wsig.Signature, sig); err != nil {
+		return "", fmt.Errorf("%w: invalid ssh signature: %s", sign.ErrUntrusted, err.Error())
+	}
+	// ssh-rsa signatures use sha1, which is not allowed
+	if sig.Format == gossh.KeyAlgoRSA {
+		return "", fmt.Errorf("%w: ssh-rsa (sha1) signatures are not allowed", sign.ErrUntrusted)
+	}
+	data, err := getSignedData(wsig.HashAlgorithm, message)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", sign.ErrUntrusted, err.Error())
+	}
+	if err := pub.Verify(data, sig); err != nil {
+		return "", fmt.Errorf("%w: %s", sign.ErrUntrusted, err.Error())
+	}
+	return gossh.FingerprintSHA256(pub), nil
+}
+
+func (r *sshVerifier) isTrusted(pub gossh.PublicKey) bool {
+	for _, key := range r.keys {
+		if bytes.Equal(key.Marshal(), pub.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// getSignedData returns the blob that is signed for the message
+func getSignedData(hashAlgorithm string, message []byte) ([]byte, error) {
+	var h hash.Hash
+	switch hashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported ssh signature hash algorithm %q", hashAlgorithm)
+	}
+	h.Write(message)
+	return append([]byte(sigMagic), gossh.Marshal(signedData{
+		Namespace:     sigNamespace,
+		HashAlgorithm: hashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...), nil
+}
@@ -0,0 +1,102 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/henderiw/git-loader/pkg/sign"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func newTestRSASigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestSignVerify(t *testing.T) {
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nmessage\n")
+	for name, key := range map[string]gossh.Signer{
+		"ed25519": newTestSigner(t),
+		"rsa":     newTestRSASigner(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			signature, err := NewSigner(key).Sign(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier, err := NewVerifierFromAuthorizedKeys(gossh.MarshalAuthorizedKey(key.PublicKey()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer, err := verifier.Verify(message, signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := gossh.FingerprintSHA256(key.PublicKey()); signer != want {
+				t.Errorf("signer = %q, want %q", signer, want)
+			}
+
+			if _, err := verifier.Verify([]byte("tampered\n"), signature); !errors.Is(err, sign.ErrUntrusted) {
+				t.Errorf("verify of a tampered message: expected %v, got %v", sign.ErrUntrusted, err)
+			}
+			if _, err := NewVerifier([]gossh.PublicKey{newTestSigner(t).PublicKey()}).Verify(message, signature); !errors.Is(err, sign.ErrUntrusted) {
+				t.Errorf("verify with another key: expected %v, got %v", sign.ErrUntrusted, err)
+			}
+			if _, err := verifier.Verify(message, nil); !errors.Is(err, sign.ErrUnsigned) {
+				t.Errorf("verify without signature: expected %v, got %v", sign.ErrUnsigned, err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsSHA1Signatures(t *testing.T) {
+	message := []byte("message\n")
+	key := newTestRSASigner(t)
+	data, err := getSignedData(sigHashAlgorithm, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := key.(gossh.AlgorithmSigner).SignWithAlgorithm(rand.Reader, data, gossh.KeyAlgoRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append([]byte(sigMagic), gossh.Marshal(wrappedSignature{
+		Version:       sigVersion,
+		PublicKey:     key.PublicKey().Marshal(),
+		Namespace:     sigNamespace,
+		HashAlgorithm: sigHashAlgorithm,
+		Signature:     gossh.Marshal(sig),
+	})...)
+	signature := pem.EncodeToMemory(&pem.Block{Type: sigPEMType, Bytes: blob})
+
+	_, err = NewVerifier([]gossh.PublicKey{key.PublicKey()}).Verify(message, signature)
+	if !errors.Is(err, sign.ErrUntrusted) || !strings.Contains(err.Error(), "ssh-rsa") {
+		t.Errorf("expected an ssh-rsa signature to be rejected, got %v", err)
+	}
+}